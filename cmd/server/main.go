@@ -1,12 +1,19 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/IMPHNEN/imphnen-backend-qr/internal/config"
 	"github.com/IMPHNEN/imphnen-backend-qr/internal/handler"
 	"github.com/IMPHNEN/imphnen-backend-qr/internal/middleware"
 	"github.com/IMPHNEN/imphnen-backend-qr/internal/repository"
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/scheduler"
 	"github.com/IMPHNEN/imphnen-backend-qr/internal/seeder"
 	"github.com/IMPHNEN/imphnen-backend-qr/internal/service"
 	"github.com/IMPHNEN/imphnen-backend-qr/pkg/database"
@@ -25,25 +32,64 @@ func main() {
 	// Repositories
 	userRepo := repository.NewUserRepository(db)
 	qrCampaignRepo := repository.NewQRCampaignRepository(db)
+	qrScanRepo := repository.NewQRScanRepository(db)
+	imageJobRepo := repository.NewImageJobRepository(db)
+	imagePresetRepo := repository.NewImagePresetRepository(db)
+	frameTemplateRepo := repository.NewFrameTemplateRepository(db)
 
 	// Services
 	authService := service.NewAuthService(userRepo, cfg)
 	userService := service.NewUserService(userRepo)
-	qrCampaignService := service.NewQRCampaignService(qrCampaignRepo)
+	qrCampaignService := service.NewQRCampaignService(qrCampaignRepo, imagePresetRepo, frameTemplateRepo, cfg)
+	analyticsService := service.NewAnalyticsService(qrScanRepo, qrCampaignRepo, cfg)
+	imageJobService := service.NewImageJobService(imageJobRepo, qrCampaignService, cfg)
+	imagePresetService := service.NewImagePresetService(imagePresetRepo, cfg)
+	frameTemplateService := service.NewFrameTemplateService(frameTemplateRepo, cfg)
+
+	if err := qrCampaignService.NormalizeCampaignURLs(); err != nil {
+		log.Printf("[ERROR] NormalizeCampaignURLs: %v", err)
+	}
+	if err := qrCampaignService.SyncStoredQRCodes(); err != nil {
+		log.Printf("[ERROR] SyncStoredQRCodes: %v", err)
+	}
+
+	// Cancelled on SIGINT/SIGTERM so the server and background workers can
+	// shut down gracefully
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Background workers
+	analyticsService.Start()
+	defer analyticsService.Stop()
+
+	jobs := scheduler.New()
+	jobs.Add("expire-campaigns", cfg.SchedulerInterval, qrCampaignService.ExpireCampaigns)
+	jobs.Add("activate-scheduled-campaigns", cfg.SchedulerInterval, qrCampaignService.ActivateScheduledCampaigns)
+	jobs.Add("purge-image-jobs", cfg.SchedulerInterval, imageJobService.PurgeExpiredJobs)
+	jobs.Start(ctx)
+	defer jobs.Wait()
+
+	imageJobService.Start(ctx)
+	defer imageJobService.Wait()
 
 	// Handlers
 	authHandler := handler.NewAuthHandler(authService)
 	userHandler := handler.NewUserHandler(userService)
-	qrCampaignHandler := handler.NewQRCampaignHandler(qrCampaignService)
+	qrCampaignHandler := handler.NewQRCampaignHandler(qrCampaignService, analyticsService)
+	analyticsHandler := handler.NewAnalyticsHandler(analyticsService)
+	imageJobHandler := handler.NewImageJobHandler(imageJobService, qrCampaignService)
+	imagePresetHandler := handler.NewImagePresetHandler(imagePresetService)
+	frameTemplateHandler := handler.NewFrameTemplateHandler(frameTemplateService)
 
 	// Echo
 	e := echo.New()
 	e.Use(echoMiddleware.Logger())
 	e.Use(echoMiddleware.Recover())
 	e.Use(echoMiddleware.CORSWithConfig(echoMiddleware.CORSConfig{
-		AllowOrigins: []string{"*"},
-		AllowMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders: []string{"Content-Type", "Authorization"},
+		AllowOrigins:  []string{"*"},
+		AllowMethods:  []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders:  []string{"Content-Type", "Authorization"},
+		ExposeHeaders: []string{"X-QR-Position", "X-QR-Warning"},
 	}))
 
 	// Health check
@@ -51,6 +97,9 @@ func main() {
 		return c.JSON(200, map[string]string{"status": "ok"})
 	})
 
+	// Campaign short-link redirect (public, encoded in QR codes)
+	e.GET("/r/:code", qrCampaignHandler.Redirect)
+
 	// Auth routes (public)
 	auth := e.Group("/api/v1/auth")
 	auth.POST("/register", authHandler.Register)
@@ -81,12 +130,62 @@ func main() {
 	adminCampaigns.Use(middleware.RBACMiddleware("admin"))
 	adminCampaigns.POST("", qrCampaignHandler.CreateCampaign)
 	adminCampaigns.GET("", qrCampaignHandler.GetAllCampaigns)
+	adminCampaigns.PUT("/:id", qrCampaignHandler.UpdateCampaign)
 	adminCampaigns.PUT("/:id/activate", qrCampaignHandler.SetActiveCampaign)
+	adminCampaigns.GET("/:id/qr", qrCampaignHandler.ExportQR)
+	adminCampaigns.PUT("/:id/logo", qrCampaignHandler.UploadLogo)
+	adminCampaigns.DELETE("/:id/logo", qrCampaignHandler.DeleteLogo)
+	adminCampaigns.GET("/:id/revisions", qrCampaignHandler.GetRevisions)
+	adminCampaigns.POST("/:id/revisions/:revision/rollback", qrCampaignHandler.RollbackCampaign)
 	adminCampaigns.DELETE("/:id", qrCampaignHandler.DeleteCampaign)
+	adminCampaigns.GET("/:id/analytics", analyticsHandler.GetSummary)
+	adminCampaigns.GET("/:id/analytics/timeseries", analyticsHandler.GetTimeSeries)
+	adminCampaigns.GET("/process-image/stats", qrCampaignHandler.ProcessingStats)
+	adminCampaigns.POST("/decode", qrCampaignHandler.DecodeImage)
 
 	// Campaign routes (user - JWT only, all roles)
 	campaigns.POST("/process-image", qrCampaignHandler.ProcessImage)
-
-	log.Printf("server starting on port %s", cfg.Port)
-	e.Logger.Fatal(e.Start(":" + cfg.Port))
+	campaigns.POST("/process-image/batch", qrCampaignHandler.ProcessBatch)
+	campaigns.POST("/process-image/jobs", imageJobHandler.CreateJob)
+	campaigns.GET("/process-image/jobs/:id", imageJobHandler.GetJob)
+	campaigns.GET("/process-image/jobs/:id/result", imageJobHandler.GetJobResult)
+
+	// Image preset routes (list for all roles, changes admin only)
+	presets := e.Group("/api/v1/image-presets")
+	presets.Use(middleware.JWTMiddleware(cfg.JWTSecret))
+	presets.GET("", imagePresetHandler.GetAllPresets)
+
+	adminPresets := presets.Group("")
+	adminPresets.Use(middleware.RBACMiddleware("admin"))
+	adminPresets.POST("", imagePresetHandler.CreatePreset)
+	adminPresets.PUT("/:id", imagePresetHandler.UpdatePreset)
+	adminPresets.DELETE("/:id", imagePresetHandler.DeletePreset)
+
+	// Frame template routes (list and preview for all roles, changes admin only)
+	templates := e.Group("/api/v1/frame-templates")
+	templates.Use(middleware.JWTMiddleware(cfg.JWTSecret))
+	templates.GET("", frameTemplateHandler.GetAllTemplates)
+	templates.GET("/:id/image", frameTemplateHandler.GetTemplateImage)
+
+	adminTemplates := templates.Group("")
+	adminTemplates.Use(middleware.RBACMiddleware("admin"))
+	adminTemplates.POST("", frameTemplateHandler.CreateTemplate)
+	adminTemplates.PUT("/:id", frameTemplateHandler.UpdateTemplate)
+	adminTemplates.DELETE("/:id", frameTemplateHandler.DeleteTemplate)
+
+	go func() {
+		log.Printf("server starting on port %s", cfg.Port)
+		if err := e.Start(":" + cfg.Port); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("server error: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("shutting down server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		log.Printf("[ERROR] server shutdown: %v", err)
+	}
 }
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_qr_campaigns_short_code;
+ALTER TABLE qr_campaigns DROP COLUMN IF EXISTS short_code;
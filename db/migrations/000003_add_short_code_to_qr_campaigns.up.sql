@@ -0,0 +1,7 @@
+ALTER TABLE qr_campaigns ADD COLUMN short_code VARCHAR(16);
+
+UPDATE qr_campaigns SET short_code = substr(md5(id::text || random()::text), 1, 8) WHERE short_code IS NULL;
+
+ALTER TABLE qr_campaigns ALTER COLUMN short_code SET NOT NULL;
+
+CREATE UNIQUE INDEX idx_qr_campaigns_short_code ON qr_campaigns(short_code);
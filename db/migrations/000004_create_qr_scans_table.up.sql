@@ -0,0 +1,10 @@
+CREATE TABLE qr_scans (
+    id BIGSERIAL PRIMARY KEY,
+    campaign_id UUID NOT NULL REFERENCES qr_campaigns(id) ON DELETE CASCADE,
+    ip_hash VARCHAR(64) NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    referrer TEXT NOT NULL DEFAULT '',
+    scanned_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_qr_scans_campaign_scanned_at ON qr_scans(campaign_id, scanned_at);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_qr_campaigns_starts_at;
+ALTER TABLE qr_campaigns DROP COLUMN IF EXISTS schedule_activated_at;
+ALTER TABLE qr_campaigns DROP COLUMN IF EXISTS timezone;
+ALTER TABLE qr_campaigns DROP COLUMN IF EXISTS starts_at;
@@ -0,0 +1,5 @@
+ALTER TABLE qr_campaigns ADD COLUMN starts_at TIMESTAMP;
+ALTER TABLE qr_campaigns ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+ALTER TABLE qr_campaigns ADD COLUMN schedule_activated_at TIMESTAMP;
+
+CREATE INDEX idx_qr_campaigns_starts_at ON qr_campaigns(starts_at) WHERE starts_at IS NOT NULL;
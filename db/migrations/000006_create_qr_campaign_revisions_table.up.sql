@@ -0,0 +1,16 @@
+CREATE TABLE qr_campaign_revisions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    campaign_id UUID NOT NULL REFERENCES qr_campaigns(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    url TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    changed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (campaign_id, revision)
+);
+
+-- Record the current state of existing campaigns as their first revision
+INSERT INTO qr_campaign_revisions (campaign_id, revision, action, name, url, expires_at, changed_by, created_at)
+SELECT id, 1, 'create', name, url, expires_at, created_by, created_at FROM qr_campaigns;
@@ -0,0 +1,5 @@
+ALTER TABLE qr_campaigns DROP COLUMN IF EXISTS qr_background_color;
+ALTER TABLE qr_campaigns DROP COLUMN IF EXISTS qr_foreground_color;
+ALTER TABLE qr_campaigns DROP COLUMN IF EXISTS qr_quiet_zone;
+ALTER TABLE qr_campaigns DROP COLUMN IF EXISTS qr_size;
+ALTER TABLE qr_campaigns DROP COLUMN IF EXISTS qr_error_correction;
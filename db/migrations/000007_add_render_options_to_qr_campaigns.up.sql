@@ -0,0 +1,5 @@
+ALTER TABLE qr_campaigns ADD COLUMN qr_error_correction VARCHAR(1) NOT NULL DEFAULT 'M';
+ALTER TABLE qr_campaigns ADD COLUMN qr_size INTEGER NOT NULL DEFAULT 256;
+ALTER TABLE qr_campaigns ADD COLUMN qr_quiet_zone INTEGER NOT NULL DEFAULT 4;
+ALTER TABLE qr_campaigns ADD COLUMN qr_foreground_color VARCHAR(7) NOT NULL DEFAULT '#000000';
+ALTER TABLE qr_campaigns ADD COLUMN qr_background_color VARCHAR(7) NOT NULL DEFAULT '#FFFFFF';
@@ -0,0 +1 @@
+ALTER TABLE qr_campaigns DROP COLUMN IF EXISTS logo_data;
@@ -0,0 +1 @@
+ALTER TABLE qr_campaigns ADD COLUMN logo_data BYTEA;
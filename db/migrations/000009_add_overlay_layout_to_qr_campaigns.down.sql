@@ -0,0 +1,6 @@
+ALTER TABLE qr_campaigns DROP COLUMN IF EXISTS overlay_plate_color;
+ALTER TABLE qr_campaigns DROP COLUMN IF EXISTS overlay_padding;
+ALTER TABLE qr_campaigns DROP COLUMN IF EXISTS overlay_size_ratio;
+ALTER TABLE qr_campaigns DROP COLUMN IF EXISTS overlay_y;
+ALTER TABLE qr_campaigns DROP COLUMN IF EXISTS overlay_x;
+ALTER TABLE qr_campaigns DROP COLUMN IF EXISTS overlay_position;
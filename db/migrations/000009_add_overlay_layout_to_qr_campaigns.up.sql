@@ -0,0 +1,6 @@
+ALTER TABLE qr_campaigns ADD COLUMN overlay_position VARCHAR(20) NOT NULL DEFAULT 'bottom-right';
+ALTER TABLE qr_campaigns ADD COLUMN overlay_x VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE qr_campaigns ADD COLUMN overlay_y VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE qr_campaigns ADD COLUMN overlay_size_ratio DOUBLE PRECISION NOT NULL DEFAULT 0.2;
+ALTER TABLE qr_campaigns ADD COLUMN overlay_padding INTEGER NOT NULL DEFAULT 10;
+ALTER TABLE qr_campaigns ADD COLUMN overlay_plate_color VARCHAR(7) NOT NULL DEFAULT '';
@@ -0,0 +1,23 @@
+CREATE TABLE image_jobs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    campaign_id UUID NOT NULL REFERENCES qr_campaigns(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    options JSONB NOT NULL DEFAULT '{}',
+    input_data BYTEA,
+    result_data BYTEA,
+    result_content_type VARCHAR(64) NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 3,
+    run_after TIMESTAMP NOT NULL DEFAULT NOW(),
+    locked_at TIMESTAMP,
+    completed_at TIMESTAMP,
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Workers poll for due pending jobs and stale running ones
+CREATE INDEX idx_image_jobs_claim ON image_jobs(status, run_after);
+CREATE INDEX idx_image_jobs_expires_at ON image_jobs(expires_at) WHERE expires_at IS NOT NULL;
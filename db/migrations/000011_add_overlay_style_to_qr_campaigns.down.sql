@@ -0,0 +1,4 @@
+ALTER TABLE qr_campaigns DROP COLUMN IF EXISTS overlay_caption_color;
+ALTER TABLE qr_campaigns DROP COLUMN IF EXISTS overlay_caption;
+ALTER TABLE qr_campaigns DROP COLUMN IF EXISTS overlay_plate_radius;
+ALTER TABLE qr_campaigns DROP COLUMN IF EXISTS overlay_plate_opacity;
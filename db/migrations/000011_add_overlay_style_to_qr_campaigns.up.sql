@@ -0,0 +1,4 @@
+ALTER TABLE qr_campaigns ADD COLUMN overlay_plate_opacity DOUBLE PRECISION NOT NULL DEFAULT 1;
+ALTER TABLE qr_campaigns ADD COLUMN overlay_plate_radius DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE qr_campaigns ADD COLUMN overlay_caption VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE qr_campaigns ADD COLUMN overlay_caption_color VARCHAR(7) NOT NULL DEFAULT '';
@@ -0,0 +1,13 @@
+CREATE TABLE image_presets (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(50) NOT NULL UNIQUE,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO image_presets (name, width, height) VALUES
+    ('instagram-feed', 1080, 1080),
+    ('instagram-story', 1080, 1920),
+    ('x-post', 1600, 900);
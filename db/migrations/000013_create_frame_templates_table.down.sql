@@ -0,0 +1 @@
+DROP TABLE IF EXISTS frame_templates;
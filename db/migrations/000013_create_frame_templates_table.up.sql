@@ -0,0 +1,17 @@
+CREATE TABLE frame_templates (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(100) NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    window_x INTEGER NOT NULL,
+    window_y INTEGER NOT NULL,
+    window_width INTEGER NOT NULL,
+    window_height INTEGER NOT NULL,
+    slot_x INTEGER NOT NULL,
+    slot_y INTEGER NOT NULL,
+    slot_width INTEGER NOT NULL,
+    slot_height INTEGER NOT NULL,
+    image_data BYTEA NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
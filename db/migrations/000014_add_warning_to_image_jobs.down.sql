@@ -0,0 +1 @@
+ALTER TABLE image_jobs DROP COLUMN IF EXISTS warning;
@@ -0,0 +1 @@
+ALTER TABLE image_jobs ADD COLUMN warning TEXT NOT NULL DEFAULT '';
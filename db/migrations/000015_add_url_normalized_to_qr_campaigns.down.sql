@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_qr_campaigns_url_normalized;
+ALTER TABLE qr_campaigns DROP COLUMN IF EXISTS url_normalized;
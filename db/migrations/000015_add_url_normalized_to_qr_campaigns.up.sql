@@ -0,0 +1,4 @@
+-- Filled by the application, which also normalizes existing rows on startup
+ALTER TABLE qr_campaigns ADD COLUMN url_normalized TEXT;
+
+CREATE INDEX idx_qr_campaigns_url_normalized ON qr_campaigns(url_normalized);
@@ -2,6 +2,9 @@ package config
 
 import (
 	"log"
+	"runtime"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -13,6 +16,33 @@ type Config struct {
 	GoogleClientID     string
 	GoogleClientSecret string
 	GoogleRedirectURL  string
+	PublicBaseURL      string
+	ScanIPSalt         string
+	SchedulerInterval  time.Duration
+
+	// Limits for images uploaded to process-image
+	MaxUploadBytes     int64
+	MaxImageDimension  int
+	MaxImageMegapixels float64
+	MaxBatchFiles      int
+	MaxBatchBytes      int64
+	// Frames times canvas size of an animated GIF
+	MaxAnimationMegapixels float64
+	// Smallest printed QR module accepted when a physical size or DPI is given
+	MinModuleSizeMM float64
+	// Whether generated and overlaid QR codes are read back: off, warn or strict
+	QRVerifyMode string
+
+	// Bounded pool for CPU-heavy image processing
+	ProcessConcurrency  int
+	ProcessQueueDepth   int
+	ProcessQueueTimeout time.Duration
+
+	// Background process-image jobs
+	JobWorkers      int
+	JobPollInterval time.Duration
+	JobMaxAttempts  int
+	JobRetention    time.Duration
 }
 
 func Load() *Config {
@@ -23,18 +53,41 @@ func Load() *Config {
 	_ = viper.ReadInConfig()
 
 	cfg := &Config{
-		Port:               viper.GetString("PORT"),
-		DatabaseURL:        viper.GetString("DATABASE_URL"),
-		JWTSecret:          viper.GetString("JWT_SECRET"),
-		GoogleClientID:     viper.GetString("GOOGLE_CLIENT_ID"),
-		GoogleClientSecret: viper.GetString("GOOGLE_CLIENT_SECRET"),
-		GoogleRedirectURL:  viper.GetString("GOOGLE_REDIRECT_URL"),
+		Port:                   viper.GetString("PORT"),
+		DatabaseURL:            viper.GetString("DATABASE_URL"),
+		JWTSecret:              viper.GetString("JWT_SECRET"),
+		GoogleClientID:         viper.GetString("GOOGLE_CLIENT_ID"),
+		GoogleClientSecret:     viper.GetString("GOOGLE_CLIENT_SECRET"),
+		GoogleRedirectURL:      viper.GetString("GOOGLE_REDIRECT_URL"),
+		PublicBaseURL:          viper.GetString("PUBLIC_BASE_URL"),
+		ScanIPSalt:             viper.GetString("SCAN_IP_SALT"),
+		SchedulerInterval:      viper.GetDuration("SCHEDULER_INTERVAL"),
+		MaxUploadBytes:         viper.GetInt64("MAX_UPLOAD_BYTES"),
+		MaxImageDimension:      viper.GetInt("MAX_IMAGE_DIMENSION"),
+		MaxImageMegapixels:     viper.GetFloat64("MAX_IMAGE_MEGAPIXELS"),
+		MaxBatchFiles:          viper.GetInt("MAX_BATCH_FILES"),
+		MaxBatchBytes:          viper.GetInt64("MAX_BATCH_BYTES"),
+		MaxAnimationMegapixels: viper.GetFloat64("MAX_ANIMATION_MEGAPIXELS"),
+		MinModuleSizeMM:        viper.GetFloat64("MIN_MODULE_SIZE_MM"),
+		QRVerifyMode:           strings.ToLower(viper.GetString("QR_VERIFY_MODE")),
+		ProcessConcurrency:     viper.GetInt("PROCESS_CONCURRENCY"),
+		ProcessQueueTimeout:    viper.GetDuration("PROCESS_QUEUE_TIMEOUT"),
+		JobWorkers:             viper.GetInt("JOB_WORKERS"),
+		JobPollInterval:        viper.GetDuration("JOB_POLL_INTERVAL"),
+		JobMaxAttempts:         viper.GetInt("JOB_MAX_ATTEMPTS"),
+		JobRetention:           viper.GetDuration("JOB_RETENTION"),
 	}
 
 	if cfg.Port == "" {
 		cfg.Port = "8080"
 	}
 
+	// Base URL encoded into campaign QR codes (short-link redirects)
+	if cfg.PublicBaseURL == "" {
+		cfg.PublicBaseURL = "http://localhost:" + cfg.Port
+	}
+	cfg.PublicBaseURL = strings.TrimRight(cfg.PublicBaseURL, "/")
+
 	if cfg.DatabaseURL == "" {
 		log.Fatal("DATABASE_URL is required")
 	}
@@ -43,5 +96,69 @@ func Load() *Config {
 		log.Fatal("JWT_SECRET is required")
 	}
 
+	// Salt for hashing scanner IPs, falls back to the JWT secret
+	if cfg.ScanIPSalt == "" {
+		cfg.ScanIPSalt = cfg.JWTSecret
+	}
+
+	if cfg.SchedulerInterval <= 0 {
+		cfg.SchedulerInterval = time.Minute
+	}
+
+	if cfg.MaxUploadBytes <= 0 {
+		cfg.MaxUploadBytes = 20 << 20
+	}
+	if cfg.MaxImageDimension <= 0 {
+		cfg.MaxImageDimension = 12000
+	}
+	if cfg.MaxImageMegapixels <= 0 {
+		cfg.MaxImageMegapixels = 50
+	}
+	if cfg.MaxBatchFiles <= 0 {
+		cfg.MaxBatchFiles = 50
+	}
+	if cfg.MaxBatchBytes <= 0 {
+		cfg.MaxBatchBytes = 200 << 20
+	}
+	if cfg.MaxAnimationMegapixels <= 0 {
+		cfg.MaxAnimationMegapixels = 200
+	}
+	if cfg.MinModuleSizeMM <= 0 {
+		cfg.MinModuleSizeMM = 0.4
+	}
+	switch cfg.QRVerifyMode {
+	case "off", "warn", "strict":
+	case "":
+		cfg.QRVerifyMode = "warn"
+	default:
+		log.Fatalf("QR_VERIFY_MODE must be off, warn or strict, got %q", cfg.QRVerifyMode)
+	}
+
+	// Leave a core for the rest of the API by default
+	if cfg.ProcessConcurrency <= 0 {
+		cfg.ProcessConcurrency = max(1, runtime.NumCPU()-1)
+	}
+	// 0 is a valid depth (reject instead of queueing), so only unset means default
+	cfg.ProcessQueueDepth = 32
+	if viper.GetString("PROCESS_QUEUE_DEPTH") != "" {
+		cfg.ProcessQueueDepth = viper.GetInt("PROCESS_QUEUE_DEPTH")
+	}
+	if cfg.ProcessQueueTimeout <= 0 {
+		cfg.ProcessQueueTimeout = 10 * time.Second
+	}
+
+	if cfg.JobWorkers <= 0 {
+		cfg.JobWorkers = 2
+	}
+	if cfg.JobPollInterval <= 0 {
+		cfg.JobPollInterval = 2 * time.Second
+	}
+	if cfg.JobMaxAttempts <= 0 {
+		cfg.JobMaxAttempts = 3
+	}
+	if cfg.JobRetention <= 0 {
+		cfg.JobRetention = 24 * time.Hour
+	}
+
 	return cfg
 }
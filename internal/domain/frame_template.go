@@ -0,0 +1,42 @@
+package domain
+
+import (
+	"image"
+	"time"
+)
+
+// FrameTemplate is a branded PNG frame for process-image. The user's photo is
+// fitted into Window, which the frame should leave transparent, and the
+// campaign QR into Slot.
+type FrameTemplate struct {
+	ID        string       `json:"id"`
+	Name      string       `json:"name"`
+	Width     int          `json:"width"`
+	Height    int          `json:"height"`
+	Window    TemplateRect `json:"window"`
+	Slot      TemplateRect `json:"slot"`
+	ImageData []byte       `json:"-"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// TemplateRect is a rectangle on a frame template, in pixels
+type TemplateRect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+func (r TemplateRect) Rect() image.Rectangle {
+	return image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height)
+}
+
+type FrameTemplateRepository interface {
+	Create(template *FrameTemplate) error
+	// FindByID includes ImageData; FindAll leaves it empty
+	FindByID(id string) (*FrameTemplate, error)
+	FindAll() ([]*FrameTemplate, error)
+	Update(template *FrameTemplate) error
+	Delete(id string) error
+}
@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	ImageJobPending   = "pending"
+	ImageJobRunning   = "running"
+	ImageJobSucceeded = "succeeded"
+	ImageJobFailed    = "failed"
+)
+
+// ImageJob is a process-image request run in the background. Options holds
+// the already merged overlay and output options as JSON.
+type ImageJob struct {
+	ID                string          `json:"id"`
+	UserID            string          `json:"user_id"`
+	CampaignID        string          `json:"campaign_id"`
+	Status            string          `json:"status"`
+	Options           json.RawMessage `json:"-"`
+	InputData         []byte          `json:"-"`
+	ResultContentType string          `json:"result_content_type,omitempty"`
+	Error             string          `json:"error,omitempty"`
+	Warning           string          `json:"warning,omitempty"`
+	Attempts          int             `json:"attempts"`
+	MaxAttempts       int             `json:"max_attempts"`
+	RunAfter          time.Time       `json:"run_after"`
+	CompletedAt       *time.Time      `json:"completed_at"`
+	ExpiresAt         *time.Time      `json:"expires_at"`
+	CreatedAt         time.Time       `json:"created_at"`
+	UpdatedAt         time.Time       `json:"updated_at"`
+}
+
+type ImageJobRepository interface {
+	Create(job *ImageJob) error
+	// FindByID returns the job without its input or result data
+	FindByID(id string) (*ImageJob, error)
+	FindResult(id string) (data []byte, contentType string, err error)
+	// Claim locks the next due job (or one whose worker stalled since
+	// staleBefore), marks it running and counts the attempt.
+	Claim(now, staleBefore time.Time) (*ImageJob, error)
+	Complete(id string, data []byte, contentType, warning string, now, expiresAt time.Time) error
+	// Retry puts a claimed job back in the queue until runAfter. Without
+	// countAttempt the claim is not counted against MaxAttempts.
+	Retry(id, errMsg string, now, runAfter time.Time, countAttempt bool) error
+	Fail(id, errMsg string, now, expiresAt time.Time) error
+	DeleteExpired(now time.Time) (int64, error)
+}
@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+// ImagePreset is a named output size for process-image, such as a social
+// media format. Name is what clients pass as the preset field.
+type ImagePreset struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ImagePresetRepository interface {
+	Create(preset *ImagePreset) error
+	FindByID(id string) (*ImagePreset, error)
+	FindByName(name string) (*ImagePreset, error)
+	FindAll() ([]*ImagePreset, error)
+	Update(preset *ImagePreset) error
+	Delete(id string) error
+}
@@ -1,24 +1,105 @@
 package domain
 
-import "time"
+import (
+	"net/url"
+	"strings"
+	"time"
+)
 
 type QRCampaign struct {
-	ID         string    `json:"id"`
-	Name       string    `json:"name"`
-	URL        string    `json:"url"`
-	QRCodeData []byte    `json:"-"`
-	IsActive   bool      `json:"is_active"`
-	CreatedBy  string    `json:"created_by"`
-	ExpiresAt  time.Time `json:"expires_at"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	ID            string          `json:"id"`
+	Name          string          `json:"name"`
+	URL           string          `json:"url"`
+	ShortCode     string          `json:"short_code"`
+	QRCodeData    []byte          `json:"-"`
+	LogoData      []byte          `json:"-"`
+	HasLogo       bool            `json:"has_logo"`
+	RenderOptions QRRenderOptions `json:"render_options"`
+	Overlay       OverlayLayout   `json:"overlay"`
+	IsActive      bool            `json:"is_active"`
+	CreatedBy     string          `json:"created_by"`
+	StartsAt      *time.Time      `json:"starts_at"`
+	ExpiresAt     time.Time       `json:"expires_at"`
+	Timezone      string          `json:"timezone"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+	// ScanWarning is set (not stored) when a freshly rendered QR could not
+	// be read back
+	ScanWarning string `json:"-"`
+}
+
+// QRRenderOptions controls how a campaign's QR code is rendered.
+// ErrorCorrection is one of L, M, Q or H; colors are #RRGGBB hex strings and
+// QuietZone is measured in modules.
+type QRRenderOptions struct {
+	ErrorCorrection string `json:"error_correction"`
+	Size            int    `json:"size"`
+	QuietZone       int    `json:"quiet_zone"`
+	ForegroundColor string `json:"foreground_color"`
+	BackgroundColor string `json:"background_color"`
+}
+
+// NormalizeURL lowercases the scheme and host of an absolute URL and drops
+// trailing slashes from its path, so URLs that lead to the same page compare
+// equal. Anything else is returned unchanged.
+func NormalizeURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return raw
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = strings.TrimRight(u.RawPath, "/")
+	return u.String()
+}
+
+// IsExpired reports whether the campaign's expiry time has passed at t.
+func (c *QRCampaign) IsExpired(t time.Time) bool {
+	return !t.Before(c.ExpiresAt)
+}
+
+// OverlayLayout is the campaign's default placement of its QR on processed
+// images. X and Y are only used for the custom position and hold pixels
+// ("120") or a percentage ("25%"). An empty PlateColor means no plate and
+// "auto" uses the QR background color. PlateRadius is a fraction of the
+// plate's shorter side. An empty CaptionColor picks a contrasting color.
+type OverlayLayout struct {
+	Position     string  `json:"position"`
+	X            string  `json:"x,omitempty"`
+	Y            string  `json:"y,omitempty"`
+	SizeRatio    float64 `json:"size_ratio"`
+	Padding      int     `json:"padding"`
+	PlateColor   string  `json:"plate_color,omitempty"`
+	PlateOpacity float64 `json:"plate_opacity"`
+	PlateRadius  float64 `json:"plate_radius"`
+	Caption      string  `json:"caption,omitempty"`
+	CaptionColor string  `json:"caption_color,omitempty"`
 }
 
 type QRCampaignRepository interface {
 	Create(campaign *QRCampaign) error
 	FindByID(id string) (*QRCampaign, error)
+	FindByShortCode(code string) (*QRCampaign, error)
+	FindByURL(url string) ([]*QRCampaign, error)
+	// ReplaceQRCodeData stores data as the campaign's QR image if the stored
+	// one is still old. It reports whether the campaign was updated.
+	ReplaceQRCodeData(id string, old, data []byte) (bool, error)
+	// NormalizeURLs fills in the normalized URL of campaigns stored without
+	// one and returns how many it updated
+	NormalizeURLs() (int, error)
 	FindActive() (*QRCampaign, error)
 	FindAll() ([]*QRCampaign, error)
+	// Update locks the campaign's row, applies edit and saves the result with
+	// a revision in one transaction. It returns nil if the campaign does not
+	// exist; an error from edit cancels the update.
+	Update(id, changedBy, action string, edit func(*QRCampaign) error) (*QRCampaign, error)
+	FindRevisions(campaignID string) ([]*QRCampaignRevision, error)
+	FindRevision(campaignID string, revision int) (*QRCampaignRevision, error)
 	SetActive(id string) error
+	DeactivateExpired(now time.Time) ([]*QRCampaign, error)
+	FindOverlappingSchedule(startsAt, endsAt time.Time, includeActive bool, excludeID string) (*QRCampaign, error)
+	FindDueScheduled(now time.Time) ([]*QRCampaign, error)
+	MarkScheduleActivated(id string, at time.Time) error
 	Delete(id string) error
 }
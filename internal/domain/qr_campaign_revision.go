@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+const (
+	RevisionActionCreate   = "create"
+	RevisionActionUpdate   = "update"
+	RevisionActionRollback = "rollback"
+)
+
+// QRCampaignRevision is a snapshot of a campaign's editable fields taken after
+// every change.
+type QRCampaignRevision struct {
+	ID         string    `json:"id"`
+	CampaignID string    `json:"campaign_id"`
+	Revision   int       `json:"revision"`
+	Action     string    `json:"action"`
+	Name       string    `json:"name"`
+	URL        string    `json:"url"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	ChangedBy  *string   `json:"changed_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
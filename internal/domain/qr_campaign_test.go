@@ -0,0 +1,25 @@
+package domain
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		raw, want string
+	}{
+		{"https://example.com/promo", "https://example.com/promo"},
+		{"HTTPS://Example.COM/promo", "https://example.com/promo"},
+		{"https://example.com/Promo/Ramadhan", "https://example.com/Promo/Ramadhan"},
+		{"https://example.com/promo/", "https://example.com/promo"},
+		{"https://example.com//", "https://example.com"},
+		{"https://example.com/promo/?Ref=QR", "https://example.com/promo?Ref=QR"},
+		{"https://example.com/promo?next=/home/", "https://example.com/promo?next=/home/"},
+		{"https://example.com/a%2Fb/", "https://example.com/a%2Fb"},
+		{"example.com/Promo/", "example.com/Promo/"},
+		{"not a url", "not a url"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeURL(tt.raw); got != tt.want {
+			t.Errorf("NormalizeURL(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
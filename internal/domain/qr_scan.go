@@ -0,0 +1,32 @@
+package domain
+
+import "time"
+
+type QRScan struct {
+	ID         int64     `json:"id"`
+	CampaignID string    `json:"campaign_id"`
+	IPHash     string    `json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	Referrer   string    `json:"referrer"`
+	ScannedAt  time.Time `json:"scanned_at"`
+}
+
+type ScanSummary struct {
+	CampaignID     string     `json:"campaign_id"`
+	TotalScans     int64      `json:"total_scans"`
+	UniqueVisitors int64      `json:"unique_visitors"`
+	FirstScanAt    *time.Time `json:"first_scan_at"`
+	LastScanAt     *time.Time `json:"last_scan_at"`
+}
+
+type ScanBucket struct {
+	Bucket         time.Time `json:"bucket"`
+	TotalScans     int64     `json:"total_scans"`
+	UniqueVisitors int64     `json:"unique_visitors"`
+}
+
+type QRScanRepository interface {
+	CreateBatch(scans []*QRScan) error
+	Summary(campaignID string) (*ScanSummary, error)
+	TimeSeries(campaignID, interval string, from, to time.Time) ([]ScanBucket, error)
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/service"
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+type AnalyticsHandler struct {
+	analyticsService *service.AnalyticsService
+}
+
+func NewAnalyticsHandler(analyticsService *service.AnalyticsService) *AnalyticsHandler {
+	return &AnalyticsHandler{analyticsService: analyticsService}
+}
+
+func (h *AnalyticsHandler) GetSummary(c echo.Context) error {
+	id := c.Param("id")
+
+	summary, err := h.analyticsService.GetSummary(id)
+	if err != nil {
+		if err == service.ErrCampaignNotFound {
+			return utils.ErrorResponse(c, http.StatusNotFound, "campaign not found", "campaign_not_found")
+		}
+		log.Printf("[ERROR] GetSummary: %v", err)
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to fetch analytics", "internal_error")
+	}
+
+	return utils.SuccessResponse(c, http.StatusOK, "analytics retrieved", summary)
+}
+
+// GetTimeSeries accepts ?interval=hour|day and optional RFC3339 ?from= and ?to=.
+// Defaults to the last 24 hours for hourly and the last 30 days for daily series.
+func (h *AnalyticsHandler) GetTimeSeries(c echo.Context) error {
+	id := c.Param("id")
+
+	interval := c.QueryParam("interval")
+	if interval == "" {
+		interval = "day"
+	}
+
+	to := time.Now()
+	from := to.Add(-30 * 24 * time.Hour)
+	if interval == "hour" {
+		from = to.Add(-24 * time.Hour)
+	}
+
+	if v := c.QueryParam("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return utils.ErrorResponse(c, http.StatusBadRequest, "from must be an RFC3339 timestamp", "validation_error")
+		}
+		from = t
+	}
+	if v := c.QueryParam("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return utils.ErrorResponse(c, http.StatusBadRequest, "to must be an RFC3339 timestamp", "validation_error")
+		}
+		to = t
+	}
+
+	buckets, err := h.analyticsService.GetTimeSeries(id, interval, from, to)
+	if err != nil {
+		if err == service.ErrCampaignNotFound {
+			return utils.ErrorResponse(c, http.StatusNotFound, "campaign not found", "campaign_not_found")
+		}
+		if err == service.ErrInvalidTimeRange {
+			return utils.ErrorResponse(c, http.StatusBadRequest, "interval must be hour (max 31 days) or day (max 366 days) with from before to", "validation_error")
+		}
+		log.Printf("[ERROR] GetTimeSeries: %v", err)
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to fetch analytics", "internal_error")
+	}
+
+	return utils.SuccessResponse(c, http.StatusOK, "analytics retrieved", map[string]interface{}{
+		"interval": interval,
+		"from":     from,
+		"to":       to,
+		"buckets":  buckets,
+	})
+}
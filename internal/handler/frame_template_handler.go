@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/service"
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+type FrameTemplateHandler struct {
+	templateService *service.FrameTemplateService
+}
+
+func NewFrameTemplateHandler(templateService *service.FrameTemplateService) *FrameTemplateHandler {
+	return &FrameTemplateHandler{templateService: templateService}
+}
+
+func (h *FrameTemplateHandler) GetAllTemplates(c echo.Context) error {
+	templates, err := h.templateService.GetAllTemplates()
+	if err != nil {
+		log.Printf("[ERROR] GetAllTemplates: %v", err)
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to fetch frame templates", "internal_error")
+	}
+
+	return utils.SuccessResponse(c, http.StatusOK, "frame templates retrieved", templates)
+}
+
+// GetTemplateImage downloads the frame PNG
+func (h *FrameTemplateHandler) GetTemplateImage(c echo.Context) error {
+	t, err := h.templateService.GetTemplate(c.Param("id"))
+	if err != nil {
+		return templateError(c, "GetTemplateImage", err)
+	}
+
+	return c.Blob(http.StatusOK, "image/png", t.ImageData)
+}
+
+// CreateTemplate takes a multipart form: frame (PNG), name, and window and
+// slot as "x,y,width,height".
+func (h *FrameTemplateHandler) CreateTemplate(c echo.Context) error {
+	return h.saveTemplate(c, "")
+}
+
+// UpdateTemplate takes the same form as CreateTemplate; every field is
+// optional.
+func (h *FrameTemplateHandler) UpdateTemplate(c echo.Context) error {
+	return h.saveTemplate(c, c.Param("id"))
+}
+
+func (h *FrameTemplateHandler) saveTemplate(c echo.Context, id string) error {
+	op := "CreateTemplate"
+	if id != "" {
+		op = "UpdateTemplate"
+	}
+
+	input := service.FrameTemplateInput{Name: c.FormValue("name")}
+	if v := c.FormValue("window"); v != "" {
+		window, err := parseTemplateRect(v)
+		if err != nil {
+			return utils.ErrorResponse(c, http.StatusBadRequest, "window "+err.Error(), "validation_error")
+		}
+		input.Window = window
+	}
+	if v := c.FormValue("slot"); v != "" {
+		slot, err := parseTemplateRect(v)
+		if err != nil {
+			return utils.ErrorResponse(c, http.StatusBadRequest, "slot "+err.Error(), "validation_error")
+		}
+		input.Slot = slot
+	}
+
+	if file, err := c.FormFile("frame"); err == nil {
+		src, err := file.Open()
+		if err != nil {
+			return utils.ErrorResponse(c, http.StatusBadRequest, "failed to read frame file", "bad_request")
+		}
+		defer src.Close()
+		input.Frame = src
+	}
+
+	var t *domain.FrameTemplate
+	var err error
+	if id == "" {
+		t, err = h.templateService.CreateTemplate(input)
+	} else {
+		if input.Name == "" && input.Window == nil && input.Slot == nil && input.Frame == nil {
+			return utils.ErrorResponse(c, http.StatusBadRequest, "at least one of name, window, slot or frame is required", "validation_error")
+		}
+		t, err = h.templateService.UpdateTemplate(id, input)
+	}
+	if err != nil {
+		return templateError(c, op, err)
+	}
+
+	if id == "" {
+		return utils.SuccessResponse(c, http.StatusCreated, "frame template created", t)
+	}
+	return utils.SuccessResponse(c, http.StatusOK, "frame template updated", t)
+}
+
+func (h *FrameTemplateHandler) DeleteTemplate(c echo.Context) error {
+	if err := h.templateService.DeleteTemplate(c.Param("id")); err != nil {
+		return templateError(c, "DeleteTemplate", err)
+	}
+
+	return utils.SuccessResponse(c, http.StatusOK, "frame template deleted", nil)
+}
+
+// parseTemplateRect parses "x,y,width,height"
+func parseTemplateRect(s string) (*domain.TemplateRect, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, errors.New("must be x,y,width,height")
+	}
+	var v [4]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return nil, errors.New("must be x,y,width,height in whole pixels")
+		}
+		v[i] = n
+	}
+	return &domain.TemplateRect{X: v[0], Y: v[1], Width: v[2], Height: v[3]}, nil
+}
+
+func templateError(c echo.Context, op string, err error) error {
+	switch {
+	case errors.Is(err, service.ErrTemplateNotFound):
+		return utils.ErrorResponse(c, http.StatusNotFound, "frame template not found", "template_not_found")
+	case errors.Is(err, service.ErrInvalidTemplate), errors.Is(err, service.ErrInvalidImage):
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), "validation_error")
+	case errors.Is(err, service.ErrImageTooLarge):
+		return utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, err.Error(), "image_too_large")
+	}
+	log.Printf("[ERROR] %s: %v", op, err)
+	return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to process frame template", "internal_error")
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/service"
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+type ImageJobHandler struct {
+	jobService      *service.ImageJobService
+	campaignService *service.QRCampaignService
+}
+
+func NewImageJobHandler(jobService *service.ImageJobService, campaignService *service.QRCampaignService) *ImageJobHandler {
+	return &ImageJobHandler{jobService: jobService, campaignService: campaignService}
+}
+
+// CreateJob accepts the same form as process-image and queues it. The
+// response carries the job to poll.
+func (h *ImageJobHandler) CreateJob(c echo.Context) error {
+	upload, err := parseImageUpload(c, h.campaignService.ImageLimits())
+	if err != nil {
+		return processImageError(c, "CreateImageJob", err)
+	}
+	defer upload.file.Close()
+
+	userID := c.Get("user_id").(string)
+
+	job, err := h.jobService.Enqueue(userID, upload.file, upload.overlay, upload.output)
+	if err != nil {
+		return processImageError(c, "CreateImageJob", err)
+	}
+
+	return utils.SuccessResponse(c, http.StatusAccepted, "job queued", job)
+}
+
+func (h *ImageJobHandler) GetJob(c echo.Context) error {
+	job, err := h.jobService.GetJob(c.Param("id"), c.Get("user_id").(string), isAdmin(c))
+	if err != nil {
+		if errors.Is(err, service.ErrJobNotFound) {
+			return utils.ErrorResponse(c, http.StatusNotFound, "job not found", "job_not_found")
+		}
+		log.Printf("[ERROR] GetImageJob: %v", err)
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to fetch job", "internal_error")
+	}
+
+	return utils.SuccessResponse(c, http.StatusOK, "job retrieved", job)
+}
+
+// GetJobResult downloads the processed image once the job has succeeded
+func (h *ImageJobHandler) GetJobResult(c echo.Context) error {
+	result, err := h.jobService.GetResult(c.Param("id"), c.Get("user_id").(string), isAdmin(c))
+	if err != nil {
+		if errors.Is(err, service.ErrJobNotFound) {
+			return utils.ErrorResponse(c, http.StatusNotFound, "job not found", "job_not_found")
+		}
+		if errors.Is(err, service.ErrJobNotReady) {
+			return utils.ErrorResponse(c, http.StatusConflict, "job has not succeeded", "job_not_ready")
+		}
+		log.Printf("[ERROR] GetImageJobResult: %v", err)
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to fetch job result", "internal_error")
+	}
+
+	setQRWarning(c, result.Warning)
+	return c.Blob(http.StatusOK, result.ContentType, result.Data)
+}
+
+func isAdmin(c echo.Context) bool {
+	role, _ := c.Get("role").(string)
+	return role == "admin"
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/service"
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+type ImagePresetHandler struct {
+	presetService *service.ImagePresetService
+}
+
+func NewImagePresetHandler(presetService *service.ImagePresetService) *ImagePresetHandler {
+	return &ImagePresetHandler{presetService: presetService}
+}
+
+func (h *ImagePresetHandler) GetAllPresets(c echo.Context) error {
+	presets, err := h.presetService.GetAllPresets()
+	if err != nil {
+		log.Printf("[ERROR] GetAllPresets: %v", err)
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to fetch presets", "internal_error")
+	}
+
+	return utils.SuccessResponse(c, http.StatusOK, "presets retrieved", presets)
+}
+
+func (h *ImagePresetHandler) CreatePreset(c echo.Context) error {
+	var input service.ImagePresetInput
+	if err := c.Bind(&input); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "invalid request body", "bad_request")
+	}
+
+	if input.Name == "" || input.Width == 0 || input.Height == 0 {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "name, width and height are required", "validation_error")
+	}
+
+	preset, err := h.presetService.CreatePreset(input)
+	if err != nil {
+		return presetError(c, "CreatePreset", err)
+	}
+
+	return utils.SuccessResponse(c, http.StatusCreated, "preset created", preset)
+}
+
+func (h *ImagePresetHandler) UpdatePreset(c echo.Context) error {
+	var input service.ImagePresetInput
+	if err := c.Bind(&input); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "invalid request body", "bad_request")
+	}
+
+	if input.Name == "" && input.Width == 0 && input.Height == 0 {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "at least one of name, width or height is required", "validation_error")
+	}
+
+	preset, err := h.presetService.UpdatePreset(c.Param("id"), input)
+	if err != nil {
+		return presetError(c, "UpdatePreset", err)
+	}
+
+	return utils.SuccessResponse(c, http.StatusOK, "preset updated", preset)
+}
+
+func (h *ImagePresetHandler) DeletePreset(c echo.Context) error {
+	if err := h.presetService.DeletePreset(c.Param("id")); err != nil {
+		return presetError(c, "DeletePreset", err)
+	}
+
+	return utils.SuccessResponse(c, http.StatusOK, "preset deleted", nil)
+}
+
+func presetError(c echo.Context, op string, err error) error {
+	switch {
+	case errors.Is(err, service.ErrPresetNotFound):
+		return utils.ErrorResponse(c, http.StatusNotFound, "preset not found", "preset_not_found")
+	case errors.Is(err, service.ErrPresetExists):
+		return utils.ErrorResponse(c, http.StatusConflict, err.Error(), "preset_exists")
+	case errors.Is(err, service.ErrInvalidPreset):
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), "validation_error")
+	}
+	log.Printf("[ERROR] %s: %v", op, err)
+	return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to save preset", "internal_error")
+}
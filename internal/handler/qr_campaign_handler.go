@@ -1,20 +1,31 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/IMPHNEN/imphnen-backend-qr/internal/service"
 	"github.com/IMPHNEN/imphnen-backend-qr/internal/utils"
 	"github.com/labstack/echo/v4"
 )
 
+// multipartOverhead is the room left for form fields and part headers on top
+// of the image itself
+const multipartOverhead = 1 << 20
+
 type QRCampaignHandler struct {
-	campaignService *service.QRCampaignService
+	campaignService  *service.QRCampaignService
+	analyticsService *service.AnalyticsService
 }
 
-func NewQRCampaignHandler(campaignService *service.QRCampaignService) *QRCampaignHandler {
-	return &QRCampaignHandler{campaignService: campaignService}
+func NewQRCampaignHandler(campaignService *service.QRCampaignService, analyticsService *service.AnalyticsService) *QRCampaignHandler {
+	return &QRCampaignHandler{campaignService: campaignService, analyticsService: analyticsService}
 }
 
 func (h *QRCampaignHandler) CreateCampaign(c echo.Context) error {
@@ -31,10 +42,23 @@ func (h *QRCampaignHandler) CreateCampaign(c echo.Context) error {
 
 	campaign, err := h.campaignService.CreateCampaign(input, createdBy)
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidSchedule) {
+			return utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), "validation_error")
+		}
+		if errors.Is(err, service.ErrScheduleOverlap) {
+			return utils.ErrorResponse(c, http.StatusConflict, err.Error(), "schedule_overlap")
+		}
+		if errors.Is(err, service.ErrInvalidRenderOptions) || errors.Is(err, service.ErrInvalidOverlay) {
+			return utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), "validation_error")
+		}
+		if errors.Is(err, service.ErrQRUnreadable) {
+			return utils.ErrorResponse(c, http.StatusUnprocessableEntity, err.Error(), "qr_unreadable")
+		}
 		log.Printf("[ERROR] CreateCampaign: %v", err)
 		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to create campaign", "internal_error")
 	}
 
+	setQRWarning(c, campaign.ScanWarning)
 	return utils.SuccessResponse(c, http.StatusCreated, "campaign created", campaign)
 }
 
@@ -48,10 +72,184 @@ func (h *QRCampaignHandler) GetAllCampaigns(c echo.Context) error {
 	return utils.SuccessResponse(c, http.StatusOK, "campaigns retrieved", campaigns)
 }
 
+func (h *QRCampaignHandler) UpdateCampaign(c echo.Context) error {
+	id := c.Param("id")
+
+	var input service.UpdateCampaignInput
+	if err := c.Bind(&input); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "invalid request body", "bad_request")
+	}
+
+	if input.Name == "" && input.URL == "" && input.ExpiresAt == "" && input.RenderOptions == nil && input.Overlay == nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "at least one of name, url, expires_at, render_options or overlay is required", "validation_error")
+	}
+
+	userID := c.Get("user_id").(string)
+
+	campaign, err := h.campaignService.UpdateCampaign(id, input, userID)
+	if err != nil {
+		return h.campaignEditError(c, "UpdateCampaign", err)
+	}
+
+	setQRWarning(c, campaign.ScanWarning)
+	return utils.SuccessResponse(c, http.StatusOK, "campaign updated", campaign)
+}
+
+func (h *QRCampaignHandler) GetRevisions(c echo.Context) error {
+	id := c.Param("id")
+
+	revisions, err := h.campaignService.GetRevisions(id)
+	if err != nil {
+		if err == service.ErrCampaignNotFound {
+			return utils.ErrorResponse(c, http.StatusNotFound, "campaign not found", "campaign_not_found")
+		}
+		log.Printf("[ERROR] GetRevisions: %v", err)
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to fetch revisions", "internal_error")
+	}
+
+	return utils.SuccessResponse(c, http.StatusOK, "revisions retrieved", revisions)
+}
+
+func (h *QRCampaignHandler) RollbackCampaign(c echo.Context) error {
+	id := c.Param("id")
+
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil || revision < 1 {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "revision must be a positive integer", "validation_error")
+	}
+
+	userID := c.Get("user_id").(string)
+
+	campaign, err := h.campaignService.RollbackCampaign(id, revision, userID)
+	if err != nil {
+		return h.campaignEditError(c, "RollbackCampaign", err)
+	}
+
+	setQRWarning(c, campaign.ScanWarning)
+	return utils.SuccessResponse(c, http.StatusOK, "campaign rolled back", campaign)
+}
+
+func (h *QRCampaignHandler) UploadLogo(c echo.Context) error {
+	id := c.Param("id")
+
+	file, err := c.FormFile("logo")
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "logo file is required", "validation_error")
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "failed to read logo file", "bad_request")
+	}
+	defer src.Close()
+
+	userID := c.Get("user_id").(string)
+
+	campaign, err := h.campaignService.SetCampaignLogo(id, src, userID)
+	if err != nil {
+		return h.campaignEditError(c, "UploadLogo", err)
+	}
+
+	setQRWarning(c, campaign.ScanWarning)
+	return utils.SuccessResponse(c, http.StatusOK, "campaign logo updated", campaign)
+}
+
+func (h *QRCampaignHandler) DeleteLogo(c echo.Context) error {
+	id := c.Param("id")
+	userID := c.Get("user_id").(string)
+
+	campaign, err := h.campaignService.RemoveCampaignLogo(id, userID)
+	if err != nil {
+		return h.campaignEditError(c, "DeleteLogo", err)
+	}
+
+	setQRWarning(c, campaign.ScanWarning)
+	return utils.SuccessResponse(c, http.StatusOK, "campaign logo removed", campaign)
+}
+
+// ExportQR downloads the campaign QR. Query: format=png|svg|pdf,
+// layout=single|sheet and copies (sheet only).
+func (h *QRCampaignHandler) ExportQR(c echo.Context) error {
+	id := c.Param("id")
+
+	input := service.ExportQRInput{
+		Format: c.QueryParam("format"),
+		Layout: c.QueryParam("layout"),
+	}
+	if v := c.QueryParam("copies"); v != "" {
+		copies, err := strconv.Atoi(v)
+		if err != nil {
+			return utils.ErrorResponse(c, http.StatusBadRequest, "copies must be an integer", "validation_error")
+		}
+		input.Copies = copies
+	}
+	if v := c.QueryParam("size"); v != "" {
+		size, err := service.ParseLength(v)
+		if err != nil {
+			return utils.ErrorResponse(c, http.StatusBadRequest, "size: "+err.Error(), "validation_error")
+		}
+		input.SizeMM = size
+	}
+	if v := c.QueryParam("dpi"); v != "" {
+		dpi, err := strconv.Atoi(v)
+		if err != nil {
+			return utils.ErrorResponse(c, http.StatusBadRequest, "dpi must be an integer", "validation_error")
+		}
+		input.DPI = dpi
+	}
+
+	exported, err := h.campaignService.ExportQR(id, input)
+	if err != nil {
+		if errors.Is(err, service.ErrCampaignNotFound) {
+			return utils.ErrorResponse(c, http.StatusNotFound, "campaign not found", "campaign_not_found")
+		}
+		if errors.Is(err, service.ErrInvalidExport) {
+			return utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), "validation_error")
+		}
+		log.Printf("[ERROR] ExportQR: %v", err)
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to export qr code", "internal_error")
+	}
+
+	c.Response().Header().Set("Content-Disposition", `attachment; filename="`+exported.Filename+`"`)
+	return c.Blob(http.StatusOK, exported.ContentType, exported.Data)
+}
+
+// campaignEditError maps errors from update and rollback to responses
+func (h *QRCampaignHandler) campaignEditError(c echo.Context, op string, err error) error {
+	switch {
+	case errors.Is(err, service.ErrCampaignNotFound):
+		return utils.ErrorResponse(c, http.StatusNotFound, "campaign not found", "campaign_not_found")
+	case errors.Is(err, service.ErrRevisionNotFound):
+		return utils.ErrorResponse(c, http.StatusNotFound, "revision not found", "revision_not_found")
+	case errors.Is(err, service.ErrInvalidSchedule):
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), "validation_error")
+	case errors.Is(err, service.ErrScheduleOverlap):
+		return utils.ErrorResponse(c, http.StatusConflict, err.Error(), "schedule_overlap")
+	case errors.Is(err, service.ErrInvalidRenderOptions), errors.Is(err, service.ErrInvalidOverlay):
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), "validation_error")
+	case errors.Is(err, service.ErrInvalidLogo):
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), "invalid_logo")
+	case errors.Is(err, service.ErrQRUnreadable):
+		return utils.ErrorResponse(c, http.StatusUnprocessableEntity, err.Error(), "qr_unreadable")
+	}
+	log.Printf("[ERROR] %s: %v", op, err)
+	return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to update campaign", "internal_error")
+}
+
+// setQRWarning reports a QR that could not be read back in warn mode
+func setQRWarning(c echo.Context, warning string) {
+	if warning != "" {
+		c.Response().Header().Set("X-QR-Warning", warning)
+	}
+}
+
 func (h *QRCampaignHandler) SetActiveCampaign(c echo.Context) error {
 	id := c.Param("id")
 
 	if err := h.campaignService.SetActiveCampaign(id); err != nil {
+		if err == service.ErrCampaignExpired {
+			return utils.ErrorResponse(c, http.StatusConflict, "campaign has expired", "campaign_expired")
+		}
 		log.Printf("[ERROR] SetActiveCampaign: %v", err)
 		return utils.ErrorResponse(c, http.StatusNotFound, "campaign not found", "campaign_not_found")
 	}
@@ -73,29 +271,354 @@ func (h *QRCampaignHandler) DeleteCampaign(c echo.Context) error {
 	return utils.SuccessResponse(c, http.StatusOK, "campaign deleted", nil)
 }
 
+func (h *QRCampaignHandler) Redirect(c echo.Context) error {
+	code := c.Param("code")
+
+	campaign, err := h.campaignService.ResolveShortCode(code)
+	if err != nil {
+		if err == service.ErrCampaignNotFound {
+			return utils.ErrorResponse(c, http.StatusNotFound, "campaign not found", "campaign_not_found")
+		}
+		log.Printf("[ERROR] Redirect: %v", err)
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to resolve short link", "internal_error")
+	}
+
+	req := c.Request()
+	h.analyticsService.RecordScan(campaign.ID, c.RealIP(), req.UserAgent(), req.Referer())
+
+	// Never cache the redirect, the destination may be changed by an admin
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.Redirect(http.StatusFound, campaign.URL)
+}
+
 func (h *QRCampaignHandler) ProcessImage(c echo.Context) error {
-	file, err := c.FormFile("image")
+	upload, err := parseImageUpload(c, h.campaignService.ImageLimits())
 	if err != nil {
-		return utils.ErrorResponse(c, http.StatusBadRequest, "image file is required", "validation_error")
+		return processImageError(c, "ProcessImage", err)
 	}
+	defer upload.file.Close()
 
-	src, err := file.Open()
+	result, err := h.campaignService.ProcessImage(c.Request().Context(), upload.file, upload.overlay, upload.output)
 	if err != nil {
-		return utils.ErrorResponse(c, http.StatusBadRequest, "failed to read image file", "bad_request")
+		return processImageError(c, "ProcessImage", err)
+	}
+
+	c.Response().Header().Add(echo.HeaderVary, "Accept")
+	c.Response().Header().Set("X-QR-Position", result.Position)
+	setQRWarning(c, result.Warning)
+	return c.Blob(http.StatusOK, result.ContentType, result.Data)
+}
+
+// ProcessBatch accepts several image parts (or ZIP archives of images) and
+// returns a ZIP of the processed images plus manifest.json. Per-file errors
+// are listed in the manifest instead of failing the request.
+func (h *QRCampaignHandler) ProcessBatch(c echo.Context) error {
+	limits := h.campaignService.ImageLimits()
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, limits.MaxBatchBytes+multipartOverhead)
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("batch exceeds %d bytes", limits.MaxBatchBytes), "image_too_large")
+		}
+		return utils.ErrorResponse(c, http.StatusBadRequest, "invalid multipart form", "bad_request")
+	}
+	fileHeaders := form.File["image"]
+	if len(fileHeaders) == 0 {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "at least one image file is required", "validation_error")
 	}
-	defer src.Close()
 
-	result, err := h.campaignService.ProcessImage(src)
+	overlay, err := parseOverlayOptions(c)
 	if err != nil {
-		if err == service.ErrNoActiveCampaign {
-			return utils.ErrorResponse(c, http.StatusNotFound, "no active campaign", "no_active_campaign")
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), "validation_error")
+	}
+	output, err := parseOutputOptions(c)
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), "validation_error")
+	}
+
+	images := make([]service.BatchImage, 0, len(fileHeaders))
+	for _, fh := range fileHeaders {
+		file, err := fh.Open()
+		if err != nil {
+			return utils.ErrorResponse(c, http.StatusBadRequest, "failed to read image file", "bad_request")
 		}
-		if err == service.ErrInvalidImage {
-			return utils.ErrorResponse(c, http.StatusBadRequest, "invalid image format, only PNG and JPEG are supported", "invalid_image")
+		defer file.Close()
+		images = append(images, service.BatchImage{Name: fh.Filename, File: file, Size: fh.Size})
+	}
+
+	started := false
+	err = h.campaignService.ProcessBatch(req.Context(), images, overlay, output, func() io.Writer {
+		started = true
+		c.Response().Header().Set(echo.HeaderContentType, "application/zip")
+		c.Response().Header().Set("Content-Disposition", `attachment; filename="processed.zip"`)
+		c.Response().WriteHeader(http.StatusOK)
+		return c.Response()
+	})
+	switch {
+	case err == nil:
+		return nil
+	case started:
+		// Part of the ZIP is already sent, so the client gets a truncated archive
+		log.Printf("[ERROR] ProcessBatch: %v", err)
+		return nil
+	case errors.Is(err, service.ErrInvalidBatch):
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), "validation_error")
+	}
+	return processImageError(c, "ProcessBatch", err)
+}
+
+// requestError is a client error found while parsing a request
+type requestError struct {
+	status  int
+	message string
+	code    string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+// imageUpload is the process-image multipart form
+type imageUpload struct {
+	file    multipart.File
+	overlay service.OverlayOptions
+	output  service.OutputOptions
+}
+
+// parseImageUpload opens the image form file and parses the overlay and
+// output fields. The caller must close the file.
+func parseImageUpload(c echo.Context, limits service.ImageLimits) (*imageUpload, error) {
+	// Stop reading oversized bodies early; the service checks the exact limit
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, limits.MaxBytes+multipartOverhead)
+	tooLarge := &requestError{http.StatusRequestEntityTooLarge, fmt.Sprintf("upload exceeds %d bytes", limits.MaxBytes), "image_too_large"}
+
+	fileHeader, err := c.FormFile("image")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, tooLarge
+		}
+		return nil, &requestError{http.StatusBadRequest, "image file is required", "validation_error"}
+	}
+	if fileHeader.Size > limits.MaxBytes {
+		return nil, tooLarge
+	}
+
+	overlay, err := parseOverlayOptions(c)
+	if err != nil {
+		return nil, &requestError{http.StatusBadRequest, err.Error(), "validation_error"}
+	}
+	output, err := parseOutputOptions(c)
+	if err != nil {
+		return nil, &requestError{http.StatusBadRequest, err.Error(), "validation_error"}
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, &requestError{http.StatusBadRequest, "failed to read image file", "bad_request"}
+	}
+	return &imageUpload{file: file, overlay: overlay, output: output}, nil
+}
+
+// processImageError maps errors from parsing and processing an upload
+func processImageError(c echo.Context, op string, err error) error {
+	var reqErr *requestError
+	switch {
+	case errors.As(err, &reqErr):
+		return utils.ErrorResponse(c, reqErr.status, reqErr.message, reqErr.code)
+	case errors.Is(err, service.ErrInvalidOverlay), errors.Is(err, service.ErrInvalidOutput):
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), "validation_error")
+	case err == service.ErrNoActiveCampaign:
+		return utils.ErrorResponse(c, http.StatusNotFound, "no active campaign", "no_active_campaign")
+	case err == service.ErrCampaignExpired:
+		return utils.ErrorResponse(c, http.StatusGone, "active campaign has expired", "campaign_expired")
+	case errors.Is(err, service.ErrServerBusy):
+		c.Response().Header().Set("Retry-After", "5")
+		return utils.ErrorResponse(c, http.StatusServiceUnavailable, "image processing is at capacity, try again later", "server_busy")
+	case errors.Is(err, service.ErrImageTooLarge):
+		return utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, err.Error(), "image_too_large")
+	case err == service.ErrInvalidImage:
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error(), "invalid_image")
+	case errors.Is(err, service.ErrQRUnreadable):
+		return utils.ErrorResponse(c, http.StatusUnprocessableEntity, err.Error(), "qr_unreadable")
+	}
+	log.Printf("[ERROR] %s: %v", op, err)
+	return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to process image", "internal_error")
+}
+
+// ProcessingStats reports the image processing pool: active jobs, queue
+// length and rejection counters.
+func (h *QRCampaignHandler) ProcessingStats(c echo.Context) error {
+	return utils.SuccessResponse(c, http.StatusOK, "processing stats retrieved", h.campaignService.ProcessingStats())
+}
+
+// DecodeImage finds the QR codes in an uploaded image and returns each
+// payload with its position and the campaigns it belongs to.
+func (h *QRCampaignHandler) DecodeImage(c echo.Context) error {
+	upload, err := parseImageUpload(c, h.campaignService.ImageLimits())
+	if err != nil {
+		return processImageError(c, "DecodeImage", err)
+	}
+	defer upload.file.Close()
+
+	codes, err := h.campaignService.DecodeImage(c.Request().Context(), upload.file)
+	if err != nil {
+		return processImageError(c, "DecodeImage", err)
+	}
+	return utils.SuccessResponse(c, http.StatusOK, "image decoded", map[string]interface{}{"codes": codes})
+}
+
+// parseOutputOptions reads the format, quality and metadata (keep|strip)
+// form fields. Without a format field, the most preferred image type in the
+// Accept header is used.
+func parseOutputOptions(c echo.Context) (service.OutputOptions, error) {
+	opts := service.OutputOptions{
+		Format:     c.FormValue("format"),
+		Preset:     c.FormValue("preset"),
+		TemplateID: c.FormValue("template_id"),
+		Verify:     c.FormValue("verify"),
+	}
+	if opts.Format == "" {
+		opts.Format = acceptedImageFormat(c.Request().Header.Get(echo.HeaderAccept))
+	}
+	if v := c.FormValue("quality"); v != "" {
+		quality, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, errors.New("quality must be an integer")
+		}
+		opts.Quality = quality
+	}
+	switch c.FormValue("metadata") {
+	case "", "strip":
+	case "keep":
+		opts.KeepMetadata = true
+	default:
+		return opts, errors.New("metadata must be keep or strip")
+	}
+	if v := c.FormValue("dpi"); v != "" {
+		dpi, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, errors.New("dpi must be an integer")
+		}
+		opts.DPI = dpi
+	}
+	return opts, nil
+}
+
+// acceptedImageFormat returns the supported image format with the highest
+// q-value in an Accept header. Wildcards and unsupported types are ignored,
+// so "" means "keep the input format".
+func acceptedImageFormat(accept string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		format, ok := service.ImageFormatForMediaType(strings.TrimSpace(params[0]))
+		if !ok {
+			continue
+		}
+		q := 1.0
+		for _, p := range params[1:] {
+			if v, found := strings.CutPrefix(strings.TrimSpace(p), "q="); found {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	return best
+}
+
+// parseOverlayOptions reads the optional placement fields of the
+// process-image form: position, x, y, size_ratio, padding, opacity,
+// plate_color ("none" disables the campaign's plate), plate_opacity,
+// plate_radius, caption ("none" disables the campaign's caption),
+// caption_color, resample and qr_size (a physical size such as "3cm", which
+// needs dpi).
+func parseOverlayOptions(c echo.Context) (service.OverlayOptions, error) {
+	var opts service.OverlayOptions
+	opts.Position = c.FormValue("position")
+
+	if v := c.FormValue("x"); v != "" {
+		x, err := service.ParseCoordinate(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.X = x
+	}
+	if v := c.FormValue("y"); v != "" {
+		y, err := service.ParseCoordinate(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.Y = y
+	}
+	if v := c.FormValue("size_ratio"); v != "" {
+		ratio, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return opts, errors.New("size_ratio must be a number")
+		}
+		opts.SizeRatio = &ratio
+	}
+	if v := c.FormValue("padding"); v != "" {
+		padding, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, errors.New("padding must be an integer")
+		}
+		opts.Padding = &padding
+	}
+	if v := c.FormValue("opacity"); v != "" {
+		opacity, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return opts, errors.New("opacity must be a number")
+		}
+		opts.Opacity = &opacity
+	}
+	if v := c.FormValue("plate_color"); v != "" {
+		if v == "none" {
+			v = ""
+		}
+		opts.PlateColor = &v
+	}
+	if v := c.FormValue("plate_opacity"); v != "" {
+		plateOpacity, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return opts, errors.New("plate_opacity must be a number")
+		}
+		opts.PlateOpacity = &plateOpacity
+	}
+	if v := c.FormValue("plate_radius"); v != "" {
+		plateRadius, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return opts, errors.New("plate_radius must be a number")
+		}
+		opts.PlateRadius = &plateRadius
+	}
+	if v := strings.TrimSpace(c.FormValue("caption")); v != "" {
+		if v == "none" {
+			v = ""
+		}
+		opts.Caption = &v
+	}
+	if v := c.FormValue("caption_color"); v != "" {
+		opts.CaptionColor = &v
+	}
+	if v := c.FormValue("resample"); v != "" {
+		opts.Resample = &v
+	}
+	if v := c.FormValue("qr_size"); v != "" {
+		size, err := service.ParseLength(v)
+		if err != nil {
+			return opts, fmt.Errorf("qr_size: %w", err)
 		}
-		log.Printf("[ERROR] ProcessImage: %v", err)
-		return utils.ErrorResponse(c, http.StatusInternalServerError, "failed to process image", "internal_error")
+		opts.PrintSize = &size
 	}
 
-	return c.Blob(http.StatusOK, "image/png", result)
+	return opts, nil
 }
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+	"github.com/google/uuid"
+)
+
+const frameTemplateColumns = `id, name, width, height,
+		window_x, window_y, window_width, window_height,
+		slot_x, slot_y, slot_width, slot_height, created_at, updated_at`
+
+type frameTemplateRepository struct {
+	db *sql.DB
+}
+
+func NewFrameTemplateRepository(db *sql.DB) domain.FrameTemplateRepository {
+	return &frameTemplateRepository{db: db}
+}
+
+// scanFrameTemplate reads frameTemplateColumns followed by extra
+func scanFrameTemplate(row rowScanner, extra ...interface{}) (*domain.FrameTemplate, error) {
+	t := &domain.FrameTemplate{}
+	dest := []interface{}{&t.ID, &t.Name, &t.Width, &t.Height,
+		&t.Window.X, &t.Window.Y, &t.Window.Width, &t.Window.Height,
+		&t.Slot.X, &t.Slot.Y, &t.Slot.Width, &t.Slot.Height, &t.CreatedAt, &t.UpdatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (r *frameTemplateRepository) Create(t *domain.FrameTemplate) error {
+	if t.ID == "" {
+		t.ID = uuid.New().String()
+	}
+	now := time.Now()
+	t.CreatedAt = now
+	t.UpdatedAt = now
+
+	_, err := r.db.Exec(
+		`INSERT INTO frame_templates (id, name, width, height,
+			window_x, window_y, window_width, window_height,
+			slot_x, slot_y, slot_width, slot_height, image_data, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+		t.ID, t.Name, t.Width, t.Height,
+		t.Window.X, t.Window.Y, t.Window.Width, t.Window.Height,
+		t.Slot.X, t.Slot.Y, t.Slot.Width, t.Slot.Height, t.ImageData, t.CreatedAt, t.UpdatedAt,
+	)
+	return err
+}
+
+func (r *frameTemplateRepository) FindByID(id string) (*domain.FrameTemplate, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, nil
+	}
+
+	var data []byte
+	t, err := scanFrameTemplate(r.db.QueryRow(
+		`SELECT `+frameTemplateColumns+`, image_data FROM frame_templates WHERE id = $1::uuid`, id,
+	), &data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.ImageData = data
+	return t, nil
+}
+
+func (r *frameTemplateRepository) FindAll() ([]*domain.FrameTemplate, error) {
+	rows, err := r.db.Query(`SELECT ` + frameTemplateColumns + ` FROM frame_templates ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []*domain.FrameTemplate
+	for rows.Next() {
+		t, err := scanFrameTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	return templates, rows.Err()
+}
+
+func (r *frameTemplateRepository) Update(t *domain.FrameTemplate) error {
+	t.UpdatedAt = time.Now()
+	_, err := r.db.Exec(
+		`UPDATE frame_templates SET name = $1, width = $2, height = $3,
+			window_x = $4, window_y = $5, window_width = $6, window_height = $7,
+			slot_x = $8, slot_y = $9, slot_width = $10, slot_height = $11, image_data = $12, updated_at = $13
+		 WHERE id = $14::uuid`,
+		t.Name, t.Width, t.Height,
+		t.Window.X, t.Window.Y, t.Window.Width, t.Window.Height,
+		t.Slot.X, t.Slot.Y, t.Slot.Width, t.Slot.Height, t.ImageData, t.UpdatedAt, t.ID,
+	)
+	return err
+}
+
+func (r *frameTemplateRepository) Delete(id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return err
+	}
+
+	_, err := r.db.Exec(`DELETE FROM frame_templates WHERE id = $1::uuid`, id)
+	return err
+}
@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+	"github.com/google/uuid"
+)
+
+const imageJobColumns = `id, user_id, campaign_id, status, options, result_content_type, error, warning,
+	attempts, max_attempts, run_after, completed_at, expires_at, created_at, updated_at`
+
+type imageJobRepository struct {
+	db *sql.DB
+}
+
+func NewImageJobRepository(db *sql.DB) domain.ImageJobRepository {
+	return &imageJobRepository{db: db}
+}
+
+func scanImageJob(row rowScanner) (*domain.ImageJob, error) {
+	job := &domain.ImageJob{}
+	var completedAt, expiresAt sql.NullTime
+	err := row.Scan(
+		&job.ID, &job.UserID, &job.CampaignID, &job.Status, &job.Options, &job.ResultContentType, &job.Error, &job.Warning,
+		&job.Attempts, &job.MaxAttempts, &job.RunAfter, &completedAt, &expiresAt, &job.CreatedAt, &job.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+	if expiresAt.Valid {
+		job.ExpiresAt = &expiresAt.Time
+	}
+	return job, nil
+}
+
+func (r *imageJobRepository) Create(job *domain.ImageJob) error {
+	if job.ID == "" {
+		job.ID = uuid.New().String()
+	}
+	now := time.Now()
+	job.Status = domain.ImageJobPending
+	job.RunAfter = now
+	job.CreatedAt = now
+	job.UpdatedAt = now
+
+	_, err := r.db.Exec(
+		`INSERT INTO image_jobs (id, user_id, campaign_id, status, options, input_data, max_attempts, run_after, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		job.ID, job.UserID, job.CampaignID, job.Status, string(job.Options), job.InputData, job.MaxAttempts, job.RunAfter, job.CreatedAt, job.UpdatedAt,
+	)
+	return err
+}
+
+func (r *imageJobRepository) FindByID(id string) (*domain.ImageJob, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, nil
+	}
+
+	job, err := scanImageJob(r.db.QueryRow(
+		`SELECT `+imageJobColumns+` FROM image_jobs WHERE id = $1::uuid`, id,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return job, err
+}
+
+func (r *imageJobRepository) FindResult(id string) ([]byte, string, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, "", nil
+	}
+
+	var data []byte
+	var contentType string
+	err := r.db.QueryRow(
+		`SELECT result_data, result_content_type FROM image_jobs
+		 WHERE id = $1::uuid AND status = $2`, id, domain.ImageJobSucceeded,
+	).Scan(&data, &contentType)
+	if err == sql.ErrNoRows {
+		return nil, "", nil
+	}
+	return data, contentType, err
+}
+
+// Claim uses FOR UPDATE SKIP LOCKED so concurrent workers (in this or other
+// server processes) never pick the same job.
+func (r *imageJobRepository) Claim(now, staleBefore time.Time) (*domain.ImageJob, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id string
+	err = tx.QueryRow(
+		`SELECT id FROM image_jobs
+		 WHERE (status = $1 AND run_after <= $3)
+		    OR (status = $2 AND locked_at < $4)
+		 ORDER BY run_after
+		 LIMIT 1
+		 FOR UPDATE SKIP LOCKED`,
+		domain.ImageJobPending, domain.ImageJobRunning, now, staleBefore,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := scanImageJob(tx.QueryRow(
+		`UPDATE image_jobs SET status = $2, attempts = attempts + 1, locked_at = $3, updated_at = $3
+		 WHERE id = $1
+		 RETURNING `+imageJobColumns,
+		id, domain.ImageJobRunning, now,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.QueryRow(`SELECT input_data FROM image_jobs WHERE id = $1`, id).Scan(&job.InputData); err != nil {
+		return nil, err
+	}
+
+	return job, tx.Commit()
+}
+
+func (r *imageJobRepository) Complete(id string, data []byte, contentType, warning string, now, expiresAt time.Time) error {
+	_, err := r.db.Exec(
+		`UPDATE image_jobs SET status = $2, result_data = $3, result_content_type = $4, error = '', warning = $7,
+			input_data = NULL, locked_at = NULL, completed_at = $5, expires_at = $6, updated_at = $5
+		 WHERE id = $1`,
+		id, domain.ImageJobSucceeded, data, contentType, now, expiresAt, warning,
+	)
+	return err
+}
+
+func (r *imageJobRepository) Retry(id, errMsg string, now, runAfter time.Time, countAttempt bool) error {
+	_, err := r.db.Exec(
+		`UPDATE image_jobs SET status = $2, error = $3, run_after = $4, locked_at = NULL, updated_at = $5,
+			attempts = CASE WHEN $6 THEN attempts ELSE attempts - 1 END
+		 WHERE id = $1`,
+		id, domain.ImageJobPending, errMsg, runAfter, now, countAttempt,
+	)
+	return err
+}
+
+func (r *imageJobRepository) Fail(id, errMsg string, now, expiresAt time.Time) error {
+	_, err := r.db.Exec(
+		`UPDATE image_jobs SET status = $2, error = $3, input_data = NULL, locked_at = NULL,
+			completed_at = $4, expires_at = $5, updated_at = $4
+		 WHERE id = $1`,
+		id, domain.ImageJobFailed, errMsg, now, expiresAt,
+	)
+	return err
+}
+
+func (r *imageJobRepository) DeleteExpired(now time.Time) (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM image_jobs WHERE expires_at <= $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+	"github.com/google/uuid"
+)
+
+const imagePresetColumns = `id, name, width, height, created_at, updated_at`
+
+type imagePresetRepository struct {
+	db *sql.DB
+}
+
+func NewImagePresetRepository(db *sql.DB) domain.ImagePresetRepository {
+	return &imagePresetRepository{db: db}
+}
+
+func scanImagePreset(row rowScanner) (*domain.ImagePreset, error) {
+	preset := &domain.ImagePreset{}
+	err := row.Scan(&preset.ID, &preset.Name, &preset.Width, &preset.Height, &preset.CreatedAt, &preset.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return preset, nil
+}
+
+func (r *imagePresetRepository) Create(preset *domain.ImagePreset) error {
+	if preset.ID == "" {
+		preset.ID = uuid.New().String()
+	}
+	now := time.Now()
+	preset.CreatedAt = now
+	preset.UpdatedAt = now
+
+	_, err := r.db.Exec(
+		`INSERT INTO image_presets (id, name, width, height, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		preset.ID, preset.Name, preset.Width, preset.Height, preset.CreatedAt, preset.UpdatedAt,
+	)
+	return err
+}
+
+func (r *imagePresetRepository) FindByID(id string) (*domain.ImagePreset, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, nil
+	}
+
+	preset, err := scanImagePreset(r.db.QueryRow(
+		`SELECT `+imagePresetColumns+` FROM image_presets WHERE id = $1::uuid`, id,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return preset, err
+}
+
+func (r *imagePresetRepository) FindByName(name string) (*domain.ImagePreset, error) {
+	preset, err := scanImagePreset(r.db.QueryRow(
+		`SELECT `+imagePresetColumns+` FROM image_presets WHERE name = $1`, name,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return preset, err
+}
+
+func (r *imagePresetRepository) FindAll() ([]*domain.ImagePreset, error) {
+	rows, err := r.db.Query(`SELECT ` + imagePresetColumns + ` FROM image_presets ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var presets []*domain.ImagePreset
+	for rows.Next() {
+		preset, err := scanImagePreset(rows)
+		if err != nil {
+			return nil, err
+		}
+		presets = append(presets, preset)
+	}
+	return presets, rows.Err()
+}
+
+func (r *imagePresetRepository) Update(preset *domain.ImagePreset) error {
+	preset.UpdatedAt = time.Now()
+	_, err := r.db.Exec(
+		`UPDATE image_presets SET name = $1, width = $2, height = $3, updated_at = $4 WHERE id = $5::uuid`,
+		preset.Name, preset.Width, preset.Height, preset.UpdatedAt, preset.ID,
+	)
+	return err
+}
+
+func (r *imagePresetRepository) Delete(id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return err
+	}
+
+	_, err := r.db.Exec(`DELETE FROM image_presets WHERE id = $1::uuid`, id)
+	return err
+}
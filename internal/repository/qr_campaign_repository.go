@@ -8,6 +8,15 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	qrCampaignColumns = `id, name, url, short_code, qr_code_data, logo_data,
+		qr_error_correction, qr_size, qr_quiet_zone, qr_foreground_color, qr_background_color,
+		overlay_position, overlay_x, overlay_y, overlay_size_ratio, overlay_padding, overlay_plate_color,
+		overlay_plate_opacity, overlay_plate_radius, overlay_caption, overlay_caption_color,
+		is_active, created_by, starts_at, expires_at, timezone, created_at, updated_at`
+	qrCampaignRevisionColumns = `id, campaign_id, revision, action, name, url, expires_at, changed_by, created_at`
+)
+
 type qrCampaignRepository struct {
 	db *sql.DB
 }
@@ -16,6 +25,26 @@ func NewQRCampaignRepository(db *sql.DB) domain.QRCampaignRepository {
 	return &qrCampaignRepository{db: db}
 }
 
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanQRCampaign(row rowScanner) (*domain.QRCampaign, error) {
+	campaign := &domain.QRCampaign{}
+	opts := &campaign.RenderOptions
+	overlay := &campaign.Overlay
+	err := row.Scan(&campaign.ID, &campaign.Name, &campaign.URL, &campaign.ShortCode, &campaign.QRCodeData, &campaign.LogoData,
+		&opts.ErrorCorrection, &opts.Size, &opts.QuietZone, &opts.ForegroundColor, &opts.BackgroundColor,
+		&overlay.Position, &overlay.X, &overlay.Y, &overlay.SizeRatio, &overlay.Padding, &overlay.PlateColor,
+		&overlay.PlateOpacity, &overlay.PlateRadius, &overlay.Caption, &overlay.CaptionColor,
+		&campaign.IsActive, &campaign.CreatedBy, &campaign.StartsAt, &campaign.ExpiresAt, &campaign.Timezone, &campaign.CreatedAt, &campaign.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	campaign.HasLogo = len(campaign.LogoData) > 0
+	return campaign, nil
+}
+
 func (r *qrCampaignRepository) Create(campaign *domain.QRCampaign) error {
 	if campaign.ID == "" {
 		campaign.ID = uuid.New().String()
@@ -23,14 +52,174 @@ func (r *qrCampaignRepository) Create(campaign *domain.QRCampaign) error {
 	now := time.Now()
 	campaign.CreatedAt = now
 	campaign.UpdatedAt = now
+	opts := campaign.RenderOptions
+	overlay := campaign.Overlay
 
-	_, err := r.db.Exec(
-		`INSERT INTO qr_campaigns (id, name, url, qr_code_data, is_active, created_by, expires_at, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
-		campaign.ID, campaign.Name, campaign.URL, campaign.QRCodeData, campaign.IsActive,
-		campaign.CreatedBy, campaign.ExpiresAt, campaign.CreatedAt, campaign.UpdatedAt,
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`INSERT INTO qr_campaigns (id, name, url, short_code, qr_code_data,
+			qr_error_correction, qr_size, qr_quiet_zone, qr_foreground_color, qr_background_color,
+			overlay_position, overlay_x, overlay_y, overlay_size_ratio, overlay_padding, overlay_plate_color,
+			overlay_plate_opacity, overlay_plate_radius, overlay_caption, overlay_caption_color,
+			is_active, created_by, starts_at, expires_at, timezone, created_at, updated_at, url_normalized)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23,
+			$24, $25, $26, $27, $28)`,
+		campaign.ID, campaign.Name, campaign.URL, campaign.ShortCode, campaign.QRCodeData,
+		opts.ErrorCorrection, opts.Size, opts.QuietZone, opts.ForegroundColor, opts.BackgroundColor,
+		overlay.Position, overlay.X, overlay.Y, overlay.SizeRatio, overlay.Padding, overlay.PlateColor,
+		overlay.PlateOpacity, overlay.PlateRadius, overlay.Caption, overlay.CaptionColor,
+		campaign.IsActive, campaign.CreatedBy, campaign.StartsAt, campaign.ExpiresAt, campaign.Timezone, campaign.CreatedAt, campaign.UpdatedAt,
+		domain.NormalizeURL(campaign.URL),
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	// Record the initial state as the first revision
+	if _, err := insertRevision(tx, campaign, campaign.CreatedBy, domain.RevisionActionCreate); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Update loads the campaign with SELECT ... FOR UPDATE, so concurrent edits
+// wait for each other and edit always sees the latest state, then saves its
+// editable fields and records a revision snapshot in the same transaction.
+func (r *qrCampaignRepository) Update(id, changedBy, action string, edit func(*domain.QRCampaign) error) (*domain.QRCampaign, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, nil
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	campaign, err := scanQRCampaign(tx.QueryRow(
+		`SELECT `+qrCampaignColumns+` FROM qr_campaigns WHERE id = $1::uuid FOR UPDATE`, id,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := edit(campaign); err != nil {
+		return nil, err
+	}
+
+	campaign.UpdatedAt = time.Now()
+	opts := campaign.RenderOptions
+	overlay := campaign.Overlay
+	_, err = tx.Exec(
+		`UPDATE qr_campaigns SET name = $1, url = $2, qr_code_data = $3, logo_data = $4, expires_at = $5,
+			qr_error_correction = $6, qr_size = $7, qr_quiet_zone = $8, qr_foreground_color = $9, qr_background_color = $10,
+			overlay_position = $11, overlay_x = $12, overlay_y = $13, overlay_size_ratio = $14, overlay_padding = $15, overlay_plate_color = $16,
+			overlay_plate_opacity = $17, overlay_plate_radius = $18, overlay_caption = $19, overlay_caption_color = $20,
+			updated_at = $21, url_normalized = $22
+		 WHERE id = $23::uuid`,
+		campaign.Name, campaign.URL, campaign.QRCodeData, campaign.LogoData, campaign.ExpiresAt,
+		opts.ErrorCorrection, opts.Size, opts.QuietZone, opts.ForegroundColor, opts.BackgroundColor,
+		overlay.Position, overlay.X, overlay.Y, overlay.SizeRatio, overlay.Padding, overlay.PlateColor,
+		overlay.PlateOpacity, overlay.PlateRadius, overlay.Caption, overlay.CaptionColor,
+		campaign.UpdatedAt, domain.NormalizeURL(campaign.URL), campaign.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := insertRevision(tx, campaign, changedBy, action); err != nil {
+		return nil, err
+	}
+
+	return campaign, tx.Commit()
+}
+
+func (r *qrCampaignRepository) FindRevisions(campaignID string) ([]*domain.QRCampaignRevision, error) {
+	if _, err := uuid.Parse(campaignID); err != nil {
+		return nil, nil
+	}
+
+	rows, err := r.db.Query(
+		`SELECT `+qrCampaignRevisionColumns+` FROM qr_campaign_revisions
+		 WHERE campaign_id = $1::uuid ORDER BY revision DESC`, campaignID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*domain.QRCampaignRevision{}
+	for rows.Next() {
+		revision, err := scanQRCampaignRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+func (r *qrCampaignRepository) FindRevision(campaignID string, revision int) (*domain.QRCampaignRevision, error) {
+	if _, err := uuid.Parse(campaignID); err != nil {
+		return nil, nil
+	}
+
+	rev, err := scanQRCampaignRevision(r.db.QueryRow(
+		`SELECT `+qrCampaignRevisionColumns+` FROM qr_campaign_revisions
+		 WHERE campaign_id = $1::uuid AND revision = $2`, campaignID, revision,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return rev, err
+}
+
+// insertRevision snapshots the campaign with the next revision number. The
+// campaign row must already be locked by the surrounding transaction.
+func insertRevision(tx *sql.Tx, campaign *domain.QRCampaign, changedBy, action string) (*domain.QRCampaignRevision, error) {
+	revision := &domain.QRCampaignRevision{
+		ID:         uuid.New().String(),
+		CampaignID: campaign.ID,
+		Action:     action,
+		Name:       campaign.Name,
+		URL:        campaign.URL,
+		ExpiresAt:  campaign.ExpiresAt,
+		CreatedAt:  time.Now(),
+	}
+	if changedBy != "" {
+		revision.ChangedBy = &changedBy
+	}
+
+	err := tx.QueryRow(
+		`INSERT INTO qr_campaign_revisions (id, campaign_id, revision, action, name, url, expires_at, changed_by, created_at)
+		 SELECT $1, $2::uuid, COALESCE(MAX(revision), 0) + 1, $3, $4, $5, $6, $7, $8
+		 FROM qr_campaign_revisions WHERE campaign_id = $2::uuid
+		 RETURNING revision`,
+		revision.ID, revision.CampaignID, revision.Action, revision.Name, revision.URL,
+		revision.ExpiresAt, revision.ChangedBy, revision.CreatedAt,
+	).Scan(&revision.Revision)
+	if err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
+
+func scanQRCampaignRevision(row rowScanner) (*domain.QRCampaignRevision, error) {
+	revision := &domain.QRCampaignRevision{}
+	err := row.Scan(&revision.ID, &revision.CampaignID, &revision.Revision, &revision.Action, &revision.Name,
+		&revision.URL, &revision.ExpiresAt, &revision.ChangedBy, &revision.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return revision, nil
 }
 
 func (r *qrCampaignRepository) FindByID(id string) (*domain.QRCampaign, error) {
@@ -38,25 +227,99 @@ func (r *qrCampaignRepository) FindByID(id string) (*domain.QRCampaign, error) {
 		return nil, nil
 	}
 
-	campaign := &domain.QRCampaign{}
-	err := r.db.QueryRow(
-		`SELECT id, name, url, qr_code_data, is_active, created_by, expires_at, created_at, updated_at
-		 FROM qr_campaigns WHERE id = $1::uuid`, id,
-	).Scan(&campaign.ID, &campaign.Name, &campaign.URL, &campaign.QRCodeData, &campaign.IsActive,
-		&campaign.CreatedBy, &campaign.ExpiresAt, &campaign.CreatedAt, &campaign.UpdatedAt)
+	campaign, err := scanQRCampaign(r.db.QueryRow(
+		`SELECT `+qrCampaignColumns+` FROM qr_campaigns WHERE id = $1::uuid`, id,
+	))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	return campaign, err
 }
 
+func (r *qrCampaignRepository) FindByShortCode(code string) (*domain.QRCampaign, error) {
+	campaign, err := scanQRCampaign(r.db.QueryRow(
+		`SELECT `+qrCampaignColumns+` FROM qr_campaigns WHERE short_code = $1`, code,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return campaign, err
+}
+
+// FindByURL returns the campaigns whose URL equals url once both are
+// normalized (see domain.NormalizeURL).
+func (r *qrCampaignRepository) FindByURL(url string) ([]*domain.QRCampaign, error) {
+	rows, err := r.db.Query(
+		`SELECT `+qrCampaignColumns+` FROM qr_campaigns WHERE url_normalized = $1 ORDER BY created_at DESC`,
+		domain.NormalizeURL(url),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var campaigns []*domain.QRCampaign
+	for rows.Next() {
+		campaign, err := scanQRCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, campaign)
+	}
+	return campaigns, rows.Err()
+}
+
+func (r *qrCampaignRepository) ReplaceQRCodeData(id string, old, data []byte) (bool, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return false, nil
+	}
+	result, err := r.db.Exec(
+		`UPDATE qr_campaigns SET qr_code_data = $1 WHERE id = $2::uuid AND qr_code_data = $3`, data, id, old,
+	)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+func (r *qrCampaignRepository) NormalizeURLs() (int, error) {
+	rows, err := r.db.Query(`SELECT id, url FROM qr_campaigns WHERE url_normalized IS NULL`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	urls := map[string]string{}
+	for rows.Next() {
+		var id, url string
+		if err := rows.Scan(&id, &url); err != nil {
+			return 0, err
+		}
+		urls[id] = url
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for id, url := range urls {
+		if _, err := r.db.Exec(
+			`UPDATE qr_campaigns SET url_normalized = $1 WHERE id = $2::uuid AND url_normalized IS NULL`,
+			domain.NormalizeURL(url), id,
+		); err != nil {
+			return 0, err
+		}
+	}
+	return len(urls), nil
+}
+
 func (r *qrCampaignRepository) FindActive() (*domain.QRCampaign, error) {
-	campaign := &domain.QRCampaign{}
-	err := r.db.QueryRow(
-		`SELECT id, name, url, qr_code_data, is_active, created_by, expires_at, created_at, updated_at
-		 FROM qr_campaigns WHERE is_active = true LIMIT 1`,
-	).Scan(&campaign.ID, &campaign.Name, &campaign.URL, &campaign.QRCodeData, &campaign.IsActive,
-		&campaign.CreatedBy, &campaign.ExpiresAt, &campaign.CreatedAt, &campaign.UpdatedAt)
+	campaign, err := scanQRCampaign(r.db.QueryRow(
+		`SELECT ` + qrCampaignColumns + ` FROM qr_campaigns WHERE is_active = true LIMIT 1`,
+	))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -65,8 +328,7 @@ func (r *qrCampaignRepository) FindActive() (*domain.QRCampaign, error) {
 
 func (r *qrCampaignRepository) FindAll() ([]*domain.QRCampaign, error) {
 	rows, err := r.db.Query(
-		`SELECT id, name, url, qr_code_data, is_active, created_by, expires_at, created_at, updated_at
-		 FROM qr_campaigns ORDER BY created_at DESC`,
+		`SELECT ` + qrCampaignColumns + ` FROM qr_campaigns ORDER BY created_at DESC`,
 	)
 	if err != nil {
 		return nil, err
@@ -75,9 +337,8 @@ func (r *qrCampaignRepository) FindAll() ([]*domain.QRCampaign, error) {
 
 	var campaigns []*domain.QRCampaign
 	for rows.Next() {
-		campaign := &domain.QRCampaign{}
-		if err := rows.Scan(&campaign.ID, &campaign.Name, &campaign.URL, &campaign.QRCodeData, &campaign.IsActive,
-			&campaign.CreatedBy, &campaign.ExpiresAt, &campaign.CreatedAt, &campaign.UpdatedAt); err != nil {
+		campaign, err := scanQRCampaign(rows)
+		if err != nil {
 			return nil, err
 		}
 		campaigns = append(campaigns, campaign)
@@ -118,6 +379,80 @@ func (r *qrCampaignRepository) SetActive(id string) error {
 	return tx.Commit()
 }
 
+// DeactivateExpired deactivates every active campaign whose expiry has passed
+// and returns the campaigns that were switched off.
+func (r *qrCampaignRepository) DeactivateExpired(now time.Time) ([]*domain.QRCampaign, error) {
+	rows, err := r.db.Query(
+		`UPDATE qr_campaigns SET is_active = false, updated_at = $1
+		 WHERE is_active = true AND expires_at <= $1
+		 RETURNING `+qrCampaignColumns, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var campaigns []*domain.QRCampaign
+	for rows.Next() {
+		campaign, err := scanQRCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, campaign)
+	}
+	return campaigns, rows.Err()
+}
+
+// FindOverlappingSchedule returns a campaign whose window overlaps
+// [startsAt, endsAt), ignoring excludeID: one the scheduler has yet to
+// activate or, with includeActive, the active one. A campaign without
+// starts_at runs from its creation.
+func (r *qrCampaignRepository) FindOverlappingSchedule(startsAt, endsAt time.Time, includeActive bool, excludeID string) (*domain.QRCampaign, error) {
+	campaign, err := scanQRCampaign(r.db.QueryRow(
+		`SELECT `+qrCampaignColumns+` FROM qr_campaigns
+		 WHERE ((starts_at IS NOT NULL AND schedule_activated_at IS NULL) OR ($3 AND is_active))
+		   AND COALESCE(starts_at, created_at) < $2 AND expires_at > $1 AND id::text <> $4
+		 ORDER BY COALESCE(starts_at, created_at) LIMIT 1`, startsAt, endsAt, includeActive, excludeID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return campaign, err
+}
+
+// FindDueScheduled returns scheduled campaigns whose window has started but
+// that the scheduler has not activated yet, oldest start first.
+func (r *qrCampaignRepository) FindDueScheduled(now time.Time) ([]*domain.QRCampaign, error) {
+	rows, err := r.db.Query(
+		`SELECT `+qrCampaignColumns+` FROM qr_campaigns
+		 WHERE starts_at IS NOT NULL AND starts_at <= $1 AND schedule_activated_at IS NULL
+		 ORDER BY starts_at`, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var campaigns []*domain.QRCampaign
+	for rows.Next() {
+		campaign, err := scanQRCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, campaign)
+	}
+	return campaigns, rows.Err()
+}
+
+func (r *qrCampaignRepository) MarkScheduleActivated(id string, at time.Time) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return err
+	}
+
+	_, err := r.db.Exec(`UPDATE qr_campaigns SET schedule_activated_at = $1 WHERE id = $2::uuid`, at, id)
+	return err
+}
+
 func (r *qrCampaignRepository) Delete(id string) error {
 	if _, err := uuid.Parse(id); err != nil {
 		return err
@@ -0,0 +1,250 @@
+package repository
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+	"github.com/google/uuid"
+)
+
+// setCampaignTimes overwrites the columns Create fills in itself
+func setCampaignTimes(t *testing.T, db *sql.DB, id string, createdAt time.Time, scheduleActivatedAt *time.Time) {
+	t.Helper()
+	if _, err := db.Exec(`UPDATE qr_campaigns SET created_at = $1, schedule_activated_at = $2 WHERE id = $3::uuid`,
+		createdAt, scheduleActivatedAt, id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindOverlappingSchedule(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewQRCampaignRepository(db)
+	now := time.Now().Truncate(time.Second)
+	day := 24 * time.Hour
+	ptr := func(t time.Time) *time.Time { return &t }
+
+	pending := createTestCampaign(t, db, func(c *domain.QRCampaign) {
+		c.StartsAt = ptr(now.Add(10 * day))
+		c.ExpiresAt = now.Add(20 * day)
+	})
+	// Activated by the scheduler earlier, then switched off by hand
+	activated := createTestCampaign(t, db, func(c *domain.QRCampaign) {
+		c.StartsAt = ptr(now.Add(-5 * day))
+		c.ExpiresAt = now.Add(5 * day)
+	})
+	setCampaignTimes(t, db, activated.ID, now.Add(-6*day), ptr(now.Add(-5*day)))
+	// Started immediately, without starts_at
+	active := createTestCampaign(t, db, func(c *domain.QRCampaign) {
+		c.IsActive = true
+		c.ExpiresAt = now.Add(3 * day)
+	})
+	setCampaignTimes(t, db, active.ID, now.Add(-2*day), nil)
+
+	tests := []struct {
+		name          string
+		from, to      time.Duration
+		includeActive bool
+		excludeID     string
+		want          *domain.QRCampaign
+	}{
+		{"before the pending one", 0, 7 * day, false, "", nil},
+		{"ends as the pending one starts", 0, 10 * day, false, "", nil},
+		{"ends just after it starts", 0, 10*day + time.Second, false, "", pending},
+		{"inside the pending one", 12 * day, 13 * day, false, "", pending},
+		{"starts as the pending one ends", 20 * day, 30 * day, true, "", nil},
+		{"pending one excluded", 12 * day, 13 * day, false, pending.ID, nil},
+		{"active ignored", day, 2 * day, false, "", nil},
+		{"active included", day, 2 * day, true, "", active},
+		{"active excluded", day, 2 * day, true, active.ID, nil},
+		{"starts as the active one ends", 3 * day, 4 * day, true, "", nil},
+		{"nil starts_at runs from creation", -10 * day, -2 * day, true, "", nil},
+		{"overlaps its creation", -10 * day, -2*day + time.Second, true, "", active},
+		{"activated schedules are done", -day, 0, false, "", nil},
+	}
+	for _, tt := range tests {
+		got, err := repo.FindOverlappingSchedule(now.Add(tt.from), now.Add(tt.to), tt.includeActive, tt.excludeID)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		switch {
+		case tt.want == nil && got != nil:
+			t.Errorf("%s: found %q, want none", tt.name, got.ID)
+		case tt.want != nil && (got == nil || got.ID != tt.want.ID):
+			t.Errorf("%s: found %v, want %q", tt.name, got, tt.want.ID)
+		}
+	}
+}
+
+func TestUpdateSerializesEdits(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewQRCampaignRepository(db)
+	campaign := createTestCampaign(t, db, nil)
+
+	// The first edit holds the row until the second one has started
+	locked := make(chan struct{})
+	release := make(chan struct{})
+	first := make(chan error, 1)
+	go func() {
+		_, err := repo.Update(campaign.ID, campaign.CreatedBy, domain.RevisionActionUpdate, func(c *domain.QRCampaign) error {
+			close(locked)
+			<-release
+			c.LogoData = []byte("logo")
+			return nil
+		})
+		first <- err
+	}()
+	<-locked
+
+	second := make(chan error, 1)
+	go func() {
+		_, err := repo.Update(campaign.ID, campaign.CreatedBy, domain.RevisionActionUpdate, func(c *domain.QRCampaign) error {
+			if string(c.LogoData) != "logo" {
+				t.Errorf("second edit read logo %q, want the first edit's", c.LogoData)
+			}
+			c.Overlay.Caption = "Scan me"
+			return nil
+		})
+		second <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	for _, done := range []chan error{first, second} {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := repo.FindByID(campaign.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.LogoData) != "logo" || got.Overlay.Caption != "Scan me" {
+		t.Errorf("logo %q, caption %q: an edit was lost", got.LogoData, got.Overlay.Caption)
+	}
+	revisions, err := repo.FindRevisions(campaign.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 3 {
+		t.Errorf("%d revisions, want 3", len(revisions))
+	}
+}
+
+func TestUpdateEditError(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewQRCampaignRepository(db)
+	campaign := createTestCampaign(t, db, nil)
+
+	errEdit := errors.New("rejected")
+	_, err := repo.Update(campaign.ID, campaign.CreatedBy, domain.RevisionActionUpdate, func(c *domain.QRCampaign) error {
+		c.Name = "Changed"
+		return errEdit
+	})
+	if !errors.Is(err, errEdit) {
+		t.Fatalf("err = %v, want the edit's error", err)
+	}
+	got, err := repo.FindByID(campaign.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != campaign.Name {
+		t.Errorf("name = %q after a failed edit", got.Name)
+	}
+
+	for _, id := range []string{uuid.NewString(), "not-a-uuid"} {
+		got, err := repo.Update(id, campaign.CreatedBy, domain.RevisionActionUpdate, func(*domain.QRCampaign) error {
+			t.Errorf("edit called for missing campaign %q", id)
+			return nil
+		})
+		if got != nil || err != nil {
+			t.Errorf("Update(%q) = %v, %v; want nil, nil", id, got, err)
+		}
+	}
+}
+
+func TestFindByURL(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewQRCampaignRepository(db)
+	promo := createTestCampaign(t, db, func(c *domain.QRCampaign) { c.URL = "https://Example.com/Promo/" })
+	other := createTestCampaign(t, db, func(c *domain.QRCampaign) { c.URL = "https://example.com/promo" })
+	// Stored before the normalized URL was kept
+	legacy := createTestCampaign(t, db, func(c *domain.QRCampaign) { c.URL = "HTTPS://EXAMPLE.COM/Promo" })
+	if _, err := db.Exec(`UPDATE qr_campaigns SET url_normalized = NULL WHERE id = $1::uuid`, legacy.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	find := func(url string) []string {
+		t.Helper()
+		campaigns, err := repo.FindByURL(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, c := range campaigns {
+			ids = append(ids, c.ID)
+		}
+		return ids
+	}
+	if got := find("https://example.com/Promo"); len(got) != 1 || got[0] != promo.ID {
+		t.Errorf("found %v, want only %s: the path is case-sensitive", got, promo.ID)
+	}
+
+	updated, err := repo.NormalizeURLs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 1 {
+		t.Errorf("normalized %d URLs, want 1", updated)
+	}
+	if got := find("https://EXAMPLE.com/Promo//"); len(got) != 2 {
+		t.Errorf("found %v, want %s and %s", got, promo.ID, legacy.ID)
+	}
+	if got := find("https://example.com/promo/"); len(got) != 1 || got[0] != other.ID {
+		t.Errorf("found %v, want only %s", got, other.ID)
+	}
+
+	// Edits keep the normalized URL current
+	if _, err := repo.Update(other.ID, other.CreatedBy, domain.RevisionActionUpdate, func(c *domain.QRCampaign) error {
+		c.URL = "https://example.com/Promo"
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := find("https://example.com/promo"); len(got) != 0 {
+		t.Errorf("found %v under the old URL", got)
+	}
+}
+
+func TestReplaceQRCodeData(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewQRCampaignRepository(db)
+	campaign := createTestCampaign(t, db, nil)
+
+	tests := []struct {
+		name      string
+		old, data []byte
+		want      bool
+		stored    []byte
+	}{
+		{"stale", []byte{9}, []byte{2}, false, campaign.QRCodeData},
+		{"current", campaign.QRCodeData, []byte{2}, true, []byte{2}},
+		{"replaced already", campaign.QRCodeData, []byte{3}, false, []byte{2}},
+	}
+	for _, tt := range tests {
+		ok, err := repo.ReplaceQRCodeData(campaign.ID, tt.old, tt.data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got, err := repo.FindByID(campaign.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tt.want || !bytes.Equal(got.QRCodeData, tt.stored) {
+			t.Errorf("%s: replaced %v, stored %v; want %v, %v", tt.name, ok, got.QRCodeData, tt.want, tt.stored)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+)
+
+type qrScanRepository struct {
+	db *sql.DB
+}
+
+func NewQRScanRepository(db *sql.DB) domain.QRScanRepository {
+	return &qrScanRepository{db: db}
+}
+
+// CreateBatch inserts the scans in one statement. Scans of campaigns deleted
+// since they were recorded are skipped, so they cannot fail the whole batch.
+func (r *qrScanRepository) CreateBatch(scans []*domain.QRScan) error {
+	if len(scans) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, 0, len(scans))
+	args := make([]interface{}, 0, len(scans)*5)
+	for i, scan := range scans {
+		n := i * 5
+		placeholders = append(placeholders, fmt.Sprintf("($%d::uuid, $%d::text, $%d::text, $%d::text, $%d::timestamp)", n+1, n+2, n+3, n+4, n+5))
+		args = append(args, scan.CampaignID, scan.IPHash, scan.UserAgent, scan.Referrer, scan.ScannedAt)
+	}
+
+	_, err := r.db.Exec(
+		`INSERT INTO qr_scans (campaign_id, ip_hash, user_agent, referrer, scanned_at)
+		 SELECT v.campaign_id, v.ip_hash, v.user_agent, v.referrer, v.scanned_at
+		 FROM (VALUES `+strings.Join(placeholders, ", ")+`) AS v(campaign_id, ip_hash, user_agent, referrer, scanned_at)
+		 WHERE EXISTS (SELECT 1 FROM qr_campaigns c WHERE c.id = v.campaign_id)`,
+		args...,
+	)
+	return err
+}
+
+func (r *qrScanRepository) Summary(campaignID string) (*domain.ScanSummary, error) {
+	summary := &domain.ScanSummary{CampaignID: campaignID}
+	var firstScanAt, lastScanAt sql.NullTime
+	err := r.db.QueryRow(
+		`SELECT COUNT(*), COUNT(DISTINCT ip_hash), MIN(scanned_at), MAX(scanned_at)
+		 FROM qr_scans WHERE campaign_id = $1::uuid`, campaignID,
+	).Scan(&summary.TotalScans, &summary.UniqueVisitors, &firstScanAt, &lastScanAt)
+	if err != nil {
+		return nil, err
+	}
+	if firstScanAt.Valid {
+		summary.FirstScanAt = &firstScanAt.Time
+	}
+	if lastScanAt.Valid {
+		summary.LastScanAt = &lastScanAt.Time
+	}
+	return summary, nil
+}
+
+// TimeSeries returns one bucket per interval ("hour" or "day") between from and to,
+// including empty buckets so clients can plot the series directly.
+func (r *qrScanRepository) TimeSeries(campaignID, interval string, from, to time.Time) ([]domain.ScanBucket, error) {
+	rows, err := r.db.Query(
+		`SELECT b.bucket, COUNT(s.id), COUNT(DISTINCT s.ip_hash)
+		 FROM generate_series(date_trunc($2, $3::timestamp), date_trunc($2, $4::timestamp), ('1 ' || $2)::interval) AS b(bucket)
+		 LEFT JOIN qr_scans s
+		   ON s.campaign_id = $1::uuid
+		  AND s.scanned_at >= b.bucket
+		  AND s.scanned_at < b.bucket + ('1 ' || $2)::interval
+		 GROUP BY b.bucket
+		 ORDER BY b.bucket`,
+		campaignID, interval, from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []domain.ScanBucket{}
+	for rows.Next() {
+		var bucket domain.ScanBucket
+		if err := rows.Scan(&bucket.Bucket, &bucket.TotalScans, &bucket.UniqueVisitors); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, rows.Err()
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+)
+
+func TestCreateBatchSkipsDeletedCampaigns(t *testing.T) {
+	db := openTestDB(t)
+	live := createTestCampaign(t, db, nil)
+	deleted := createTestCampaign(t, db, nil)
+	if err := NewQRCampaignRepository(db).Delete(deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewQRScanRepository(db)
+	now := time.Now()
+	scans := []*domain.QRScan{
+		{CampaignID: live.ID, IPHash: "a", ScannedAt: now},
+		{CampaignID: deleted.ID, IPHash: "b", ScannedAt: now},
+		{CampaignID: live.ID, IPHash: "c", UserAgent: "test", ScannedAt: now},
+	}
+	if err := repo.CreateBatch(scans); err != nil {
+		t.Fatalf("CreateBatch: %v", err)
+	}
+
+	summary, err := repo.Summary(live.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.TotalScans != 2 || summary.UniqueVisitors != 2 {
+		t.Errorf("live campaign has %d scans from %d visitors, want 2 from 2", summary.TotalScans, summary.UniqueVisitors)
+	}
+	summary, err = repo.Summary(deleted.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.TotalScans != 0 {
+		t.Errorf("deleted campaign has %d scans, want 0", summary.TotalScans)
+	}
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"database/sql"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// openTestDB connects to TEST_DATABASE_URL and runs the migrations in a fresh
+// schema that is dropped when the test ends. Without a database the test is
+// skipped.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		admin.Close()
+		t.Fatalf("creating schema: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`)
+		admin.Close()
+	})
+
+	db, err := sql.Open("postgres", withSearchPath(dsn, schema+",public"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	files, err := filepath.Glob("../../db/migrations/*.up.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no migrations found: %v", err)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		migration, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(string(migration)); err != nil {
+			t.Fatalf("%s: %v", filepath.Base(file), err)
+		}
+	}
+	return db
+}
+
+// withSearchPath adds a search_path run-time parameter to a URL or key=value
+// connection string.
+func withSearchPath(dsn, path string) string {
+	if !strings.Contains(dsn, "://") {
+		return dsn + " search_path='" + path + "'"
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return dsn
+	}
+	q := u.Query()
+	q.Set("search_path", path)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// createTestCampaign stores an inactive campaign expiring in a month, after
+// applying edit to it.
+func createTestCampaign(t *testing.T, db *sql.DB, edit func(*domain.QRCampaign)) *domain.QRCampaign {
+	t.Helper()
+	user := &domain.User{Email: uuid.NewString() + "@example.com", Name: "Test", Role: "admin", Provider: "local"}
+	if err := NewUserRepository(db).Create(user); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	campaign := &domain.QRCampaign{
+		Name:       "Test",
+		URL:        "https://example.com",
+		ShortCode:  strings.ReplaceAll(uuid.NewString(), "-", "")[:8],
+		QRCodeData: []byte{1},
+		RenderOptions: domain.QRRenderOptions{
+			ErrorCorrection: "M", Size: 256, QuietZone: 4, ForegroundColor: "#000000", BackgroundColor: "#FFFFFF",
+		},
+		Overlay:   domain.OverlayLayout{Position: "bottom-right", SizeRatio: 0.2, Padding: 10, PlateOpacity: 1},
+		CreatedBy: user.ID,
+		ExpiresAt: time.Now().Add(30 * 24 * time.Hour),
+		Timezone:  "UTC",
+	}
+	if edit != nil {
+		edit(campaign)
+	}
+	if err := NewQRCampaignRepository(db).Create(campaign); err != nil {
+		t.Fatalf("creating campaign: %v", err)
+	}
+	return campaign
+}
@@ -0,0 +1,59 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+type job struct {
+	name     string
+	interval time.Duration
+	run      func() error
+}
+
+// Scheduler runs registered jobs on fixed intervals until its context is cancelled.
+type Scheduler struct {
+	jobs []job
+	wg   sync.WaitGroup
+}
+
+func New() *Scheduler {
+	return &Scheduler{}
+}
+
+// Add registers a job. Jobs must be added before Start is called.
+func (s *Scheduler) Add(name string, interval time.Duration, run func() error) {
+	s.jobs = append(s.jobs, job{name: name, interval: interval, run: run})
+}
+
+// Start runs every job once immediately and then on each tick of its interval.
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go func(j job) {
+			defer s.wg.Done()
+
+			ticker := time.NewTicker(j.interval)
+			defer ticker.Stop()
+
+			for {
+				if err := j.run(); err != nil {
+					log.Printf("[ERROR] scheduler job %s: %v", j.name, err)
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(j)
+	}
+}
+
+// Wait blocks until every job has stopped after the context is cancelled.
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/config"
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+)
+
+const (
+	scanBufferSize    = 4096
+	scanBatchSize     = 200
+	scanFlushInterval = 2 * time.Second
+
+	maxHourlyRange = 31 * 24 * time.Hour
+	maxDailyRange  = 366 * 24 * time.Hour
+)
+
+var ErrInvalidTimeRange = errors.New("invalid time range")
+
+// AnalyticsService records campaign QR scans and aggregates them for admins.
+// Scans are buffered in memory and written in batches by a background worker,
+// so the redirect path never waits on the database.
+type AnalyticsService struct {
+	scanRepo     domain.QRScanRepository
+	campaignRepo domain.QRCampaignRepository
+	ipSalt       string
+	scans        chan *domain.QRScan
+	done         chan struct{}
+	stopOnce     sync.Once
+}
+
+func NewAnalyticsService(scanRepo domain.QRScanRepository, campaignRepo domain.QRCampaignRepository, cfg *config.Config) *AnalyticsService {
+	return &AnalyticsService{
+		scanRepo:     scanRepo,
+		campaignRepo: campaignRepo,
+		ipSalt:       cfg.ScanIPSalt,
+		scans:        make(chan *domain.QRScan, scanBufferSize),
+		done:         make(chan struct{}),
+	}
+}
+
+// Start launches the background writer. Call Stop to flush pending scans.
+func (s *AnalyticsService) Start() {
+	go s.run()
+}
+
+// Stop closes the buffer and waits until every pending scan has been written.
+func (s *AnalyticsService) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.scans)
+		<-s.done
+	})
+}
+
+// RecordScan queues a scan without blocking. When the buffer is full the scan is dropped.
+func (s *AnalyticsService) RecordScan(campaignID, ip, userAgent, referrer string) {
+	scan := &domain.QRScan{
+		CampaignID: campaignID,
+		IPHash:     s.hashIP(ip),
+		UserAgent:  truncate(userAgent, 512),
+		Referrer:   truncate(referrer, 2048),
+		ScannedAt:  time.Now(),
+	}
+
+	select {
+	case s.scans <- scan:
+	default:
+		log.Printf("[WARN] RecordScan: buffer full, dropping scan for campaign_id = %q", campaignID)
+	}
+}
+
+func (s *AnalyticsService) GetSummary(campaignID string) (*domain.ScanSummary, error) {
+	if err := s.ensureCampaign(campaignID); err != nil {
+		return nil, err
+	}
+	return s.scanRepo.Summary(campaignID)
+}
+
+// GetTimeSeries returns scan counts bucketed by "hour" or "day" between from and to.
+func (s *AnalyticsService) GetTimeSeries(campaignID, interval string, from, to time.Time) ([]domain.ScanBucket, error) {
+	if err := s.ensureCampaign(campaignID); err != nil {
+		return nil, err
+	}
+
+	// Scan timestamps are stored in server local time
+	from, to = from.In(time.Local), to.In(time.Local)
+
+	if !to.After(from) {
+		return nil, ErrInvalidTimeRange
+	}
+	switch interval {
+	case "hour":
+		if to.Sub(from) > maxHourlyRange {
+			return nil, ErrInvalidTimeRange
+		}
+	case "day":
+		if to.Sub(from) > maxDailyRange {
+			return nil, ErrInvalidTimeRange
+		}
+	default:
+		return nil, ErrInvalidTimeRange
+	}
+
+	return s.scanRepo.TimeSeries(campaignID, interval, from, to)
+}
+
+func (s *AnalyticsService) ensureCampaign(campaignID string) error {
+	campaign, err := s.campaignRepo.FindByID(campaignID)
+	if err != nil {
+		return err
+	}
+	if campaign == nil {
+		return ErrCampaignNotFound
+	}
+	return nil
+}
+
+func (s *AnalyticsService) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(scanFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*domain.QRScan, 0, scanBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.scanRepo.CreateBatch(batch); err != nil {
+			log.Printf("[ERROR] AnalyticsService: failed to write %d scans: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case scan, ok := <-s.scans:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, scan)
+			if len(batch) >= scanBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (s *AnalyticsService) hashIP(ip string) string {
+	sum := sha256.Sum256([]byte(s.ipSalt + ip))
+	return hex.EncodeToString(sum[:])
+}
+
+// truncate cuts s to at most max bytes on a character boundary. Headers are
+// raw bytes, and invalid UTF-8 would make Postgres reject the whole batch, so
+// invalid sequences are replaced first.
+func truncate(s string, max int) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
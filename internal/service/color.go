@@ -0,0 +1,27 @@
+package service
+
+import (
+	"image/color"
+	"math"
+)
+
+// relativeLuminance returns the WCAG relative luminance of c in [0, 1]
+func relativeLuminance(c color.RGBA) float64 {
+	channel := func(v uint8) float64 {
+		s := float64(v) / 255
+		if s <= 0.03928 {
+			return s / 12.92
+		}
+		return math.Pow((s+0.055)/1.055, 2.4)
+	}
+	return 0.2126*channel(c.R) + 0.7152*channel(c.G) + 0.0722*channel(c.B)
+}
+
+// contrastRatio returns the WCAG contrast ratio between two colors (1 to 21)
+func contrastRatio(a, b color.RGBA) float64 {
+	la, lb := relativeLuminance(a), relativeLuminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/config"
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+)
+
+const (
+	maxTemplateNameLength = 100
+	minTemplateWindowSize = 32
+)
+
+var (
+	ErrTemplateNotFound = errors.New("frame template not found")
+	ErrInvalidTemplate  = errors.New("invalid frame template")
+)
+
+// FrameTemplateService manages the branded frames process-image accepts as
+// its template_id field.
+type FrameTemplateService struct {
+	repo   domain.FrameTemplateRepository
+	limits ImageLimits
+}
+
+// FrameTemplateInput creates or updates a template. Frame is the PNG itself;
+// on update, nil fields keep their current value.
+type FrameTemplateInput struct {
+	Name   string
+	Window *domain.TemplateRect
+	Slot   *domain.TemplateRect
+	Frame  io.Reader
+}
+
+func NewFrameTemplateService(repo domain.FrameTemplateRepository, cfg *config.Config) *FrameTemplateService {
+	return &FrameTemplateService{repo: repo, limits: newImageLimits(cfg)}
+}
+
+func (s *FrameTemplateService) GetAllTemplates() ([]*domain.FrameTemplate, error) {
+	return s.repo.FindAll()
+}
+
+// GetTemplate returns a template including its PNG
+func (s *FrameTemplateService) GetTemplate(id string) (*domain.FrameTemplate, error) {
+	t, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, ErrTemplateNotFound
+	}
+	return t, nil
+}
+
+func (s *FrameTemplateService) CreateTemplate(input FrameTemplateInput) (*domain.FrameTemplate, error) {
+	if input.Frame == nil || input.Window == nil || input.Slot == nil {
+		return nil, fmt.Errorf("%w: frame, window and slot are required", ErrInvalidTemplate)
+	}
+
+	t := &domain.FrameTemplate{}
+	if err := s.apply(t, input); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *FrameTemplateService) UpdateTemplate(id string, input FrameTemplateInput) (*domain.FrameTemplate, error) {
+	t, err := s.GetTemplate(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.apply(t, input); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *FrameTemplateService) DeleteTemplate(id string) error {
+	if _, err := s.GetTemplate(id); err != nil {
+		return err
+	}
+
+	return s.repo.Delete(id)
+}
+
+// apply validates input on top of t. Both rectangles must lie inside the
+// frame, so they are checked again whenever the frame is replaced.
+func (s *FrameTemplateService) apply(t *domain.FrameTemplate, input FrameTemplateInput) error {
+	if name := strings.TrimSpace(input.Name); name != "" {
+		t.Name = name
+	}
+	if input.Window != nil {
+		t.Window = *input.Window
+	}
+	if input.Slot != nil {
+		t.Slot = *input.Slot
+	}
+	if input.Frame != nil {
+		data, err := s.limits.readImage(input.Frame)
+		if err != nil {
+			return err
+		}
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil || format != ImageFormatPNG {
+			return fmt.Errorf("%w: frame must be a PNG", ErrInvalidTemplate)
+		}
+		t.ImageData, t.Width, t.Height = data, cfg.Width, cfg.Height
+	}
+
+	if t.Name == "" || utf8.RuneCountInString(t.Name) > maxTemplateNameLength {
+		return fmt.Errorf("%w: name must be 1-%d characters", ErrInvalidTemplate, maxTemplateNameLength)
+	}
+	bounds := image.Rect(0, 0, t.Width, t.Height)
+	if !t.Window.Rect().In(bounds) || t.Window.Width < minTemplateWindowSize || t.Window.Height < minTemplateWindowSize {
+		return fmt.Errorf("%w: window must be at least %dx%d pixels and inside the %dx%d frame", ErrInvalidTemplate, minTemplateWindowSize, minTemplateWindowSize, t.Width, t.Height)
+	}
+	if !t.Slot.Rect().In(bounds) || t.Slot.Width < minOverlayFitSize || t.Slot.Height < minOverlayFitSize {
+		return fmt.Errorf("%w: slot must be at least %dx%d pixels and inside the %dx%d frame", ErrInvalidTemplate, minOverlayFitSize, minOverlayFitSize, t.Width, t.Height)
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"sort"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+)
+
+var gifMagic = []byte("GIF8")
+
+// decodeAnimation decodes every frame of a GIF. A few kilobytes of GIF can
+// describe thousands of full-size frames, so the frame count times the
+// canvas size is checked against MaxAnimationMegapixels first.
+func (l ImageLimits) decodeAnimation(data []byte) (*gif.GIF, error) {
+	frames, width, height, err := scanGIF(data)
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if mp := float64(frames) * float64(width) * float64(height) / 1e6; mp > l.MaxAnimationMegapixels {
+		return nil, fmt.Errorf("%w: %d frames of %dx%d (%.1f megapixels) exceed %g", ErrImageTooLarge, frames, width, height, mp, l.MaxAnimationMegapixels)
+	}
+
+	anim, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	return anim, nil
+}
+
+// scanGIF walks the GIF block structure without decompressing anything and
+// returns the number of frames and the logical screen size.
+func scanGIF(data []byte) (frames, width, height int, err error) {
+	errMalformed := errors.New("malformed gif")
+	if len(data) < 13 || !bytes.HasPrefix(data, gifMagic) {
+		return 0, 0, 0, errMalformed
+	}
+	width = int(binary.LittleEndian.Uint16(data[6:]))
+	height = int(binary.LittleEndian.Uint16(data[8:]))
+
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << (flags&0x07 + 1)
+	}
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // extension: label, then sub-blocks
+			if pos, err = skipGIFSubBlocks(data, pos+2); err != nil {
+				return 0, 0, 0, err
+			}
+		case 0x2c: // image descriptor, optional local color table, LZW data
+			if pos+10 > len(data) {
+				return 0, 0, 0, errMalformed
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1)
+			}
+			// Skip the LZW minimum code size
+			if pos, err = skipGIFSubBlocks(data, pos+1); err != nil {
+				return 0, 0, 0, err
+			}
+			frames++
+		case 0x3b: // trailer
+			return frames, width, height, nil
+		default:
+			return 0, 0, 0, errMalformed
+		}
+	}
+	// Missing trailer; let the decoder decide whether that is fatal
+	return frames, width, height, nil
+}
+
+func skipGIFSubBlocks(data []byte, pos int) (int, error) {
+	for {
+		if pos >= len(data) {
+			return 0, errors.New("truncated gif")
+		}
+		n := int(data[pos])
+		pos++
+		if n == 0 {
+			return pos, nil
+		}
+		pos += n
+	}
+}
+
+// compositeAnimation overlays the QR on every frame of an animated GIF,
+// keeping delays and the loop count.
+//
+// The animation is played back onto a canvas so that each output frame can
+// carry exactly what is on screen at that moment. Output frames are drawn
+// without disposal over the previous ones and only write the pixels that
+// change, covering the source frame, the QR and whatever the source disposed;
+// the other pixels are transparent, so earlier content keeps its colors.
+// Pixels cannot be made transparent again that way, so when the source clears
+// any, the previous output frame is disposed to the background instead and
+// its area redrawn.
+func (s *QRCampaignService) compositeAnimation(campaign *domain.QRCampaign, anim *gif.GIF, overlay OverlayOptions, output OutputOptions) (*ProcessedImage, error) {
+	screen := image.Rect(0, 0, anim.Config.Width, anim.Config.Height)
+	canvas := image.NewRGBA(screen)
+
+	// The auto position is chosen from the first frame
+	first := image.NewRGBA(screen)
+	draw.Draw(first, anim.Image[0].Bounds(), anim.Image[0], anim.Image[0].Bounds().Min, draw.Over)
+	layer, err := s.newOverlayLayer(campaign, first, overlay, output.DPI)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &gif.GIF{
+		Image:     make([]*image.Paletted, 0, len(anim.Image)),
+		Delay:     anim.Delay,
+		Disposal:  make([]byte, len(anim.Image)),
+		LoopCount: anim.LoopCount,
+		Config:    image.Config{Width: screen.Dx(), Height: screen.Dy()},
+	}
+
+	displayed := image.NewRGBA(screen)
+	// What a viewer shows after the output frames so far
+	shown := image.NewRGBA(screen)
+	var previous *image.RGBA
+	for i, frame := range anim.Image {
+		var disposal byte
+		if i < len(anim.Disposal) {
+			disposal = anim.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(screen)
+			copy(previous.Pix, canvas.Pix)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		copy(displayed.Pix, canvas.Pix)
+		layer.drawOn(displayed)
+
+		if i > 0 {
+			last := out.Image[i-1].Bounds()
+			if clearsPixels(shown, displayed, last) {
+				out.Disposal[i-1] = gif.DisposalBackground
+				draw.Draw(shown, last, image.Transparent, image.Point{}, draw.Src)
+			}
+		}
+		rect := frame.Bounds().Union(layer.Bounds()).Union(changedBounds(shown, displayed)).Intersect(screen)
+		snapshot := quantize(displayed, shown, rect, snapshotPalette(displayed, shown, rect, layer.colors))
+		out.Image = append(out.Image, snapshot)
+		out.Disposal[i] = gif.DisposalNone
+		draw.Draw(shown, rect, snapshot, rect.Min, draw.Over)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, out); err != nil {
+		return nil, err
+	}
+	result := &ProcessedImage{Data: buf.Bytes(), ContentType: imageContentTypes[ImageFormatGIF], Format: ImageFormatGIF, Position: layer.position}
+	// Every frame carries the same QR, so reading back the first is enough
+	if err := s.verifyOutput(campaign, result, out.Image[0], layer.qrRect, output.Quality, output.verifyMode(s.verifyMode)); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// samePixel reports whether a and b look the same on screen: equal, or both
+// fully transparent.
+func samePixel(a, b []uint8) bool {
+	if a[3] == 0 && b[3] == 0 {
+		return true
+	}
+	return a[0] == b[0] && a[1] == b[1] && a[2] == b[2] && a[3] == b[3]
+}
+
+// changedBounds returns the smallest rectangle holding every pixel that
+// differs between two images of the same bounds.
+func changedBounds(a, b *image.RGBA) image.Rectangle {
+	var changed image.Rectangle
+	bounds := a.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := a.PixOffset(bounds.Min.X, y)
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			i := row + 4*(x-bounds.Min.X)
+			if !samePixel(a.Pix[i:i+4], b.Pix[i:i+4]) {
+				changed = changed.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return changed
+}
+
+// clearsPixels reports whether a pixel in rect that is visible in shown has
+// to become transparent in want.
+func clearsPixels(shown, want *image.RGBA, rect image.Rectangle) bool {
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			i := shown.PixOffset(x, y)
+			if want.Pix[i+3] == 0 && shown.Pix[i+3] != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// snapshotPalette starts with a transparent entry and the overlay's colors,
+// so QR modules map to themselves exactly, then adds the colors of the pixels
+// of src that differ from shown within rect, from most to least used, until
+// the palette holds 256 entries.
+func snapshotPalette(src, shown *image.RGBA, rect image.Rectangle, reserved []color.Color) color.Palette {
+	counts := make(map[color.RGBA]int)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			i := src.PixOffset(x, y)
+			p := src.Pix[i : i+4]
+			if !samePixel(p, shown.Pix[i:i+4]) {
+				counts[color.RGBA{R: p[0], G: p[1], B: p[2], A: p[3]}]++
+			}
+		}
+	}
+	colors := make([]color.RGBA, 0, len(counts))
+	for c := range counts {
+		colors = append(colors, c)
+	}
+	sort.Slice(colors, func(a, b int) bool {
+		ca, cb := colors[a], colors[b]
+		if counts[ca] != counts[cb] {
+			return counts[ca] > counts[cb]
+		}
+		return uint32(ca.R)<<24|uint32(ca.G)<<16|uint32(ca.B)<<8|uint32(ca.A) <
+			uint32(cb.R)<<24|uint32(cb.G)<<16|uint32(cb.B)<<8|uint32(cb.A)
+	})
+
+	palette := color.Palette{color.RGBA{}}
+	seen := map[color.RGBA]bool{{}: true}
+	for _, c := range reserved {
+		rgba := color.RGBAModel.Convert(c).(color.RGBA)
+		if !seen[rgba] {
+			seen[rgba] = true
+			palette = append(palette, rgba)
+		}
+	}
+	for _, c := range colors {
+		if len(palette) == 256 {
+			break
+		}
+		if c.A != 0 && !seen[c] {
+			seen[c] = true
+			palette = append(palette, c)
+		}
+	}
+	return palette
+}
+
+// quantize maps rect of src to the nearest palette colors without dithering,
+// which would otherwise spread noise into the QR modules. Pixels that already
+// look the same in shown get the transparent first palette entry.
+func quantize(src, shown *image.RGBA, rect image.Rectangle, palette color.Palette) *image.Paletted {
+	dst := image.NewPaletted(rect, palette)
+	cache := make(map[color.RGBA]uint8, len(palette))
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			i := src.PixOffset(x, y)
+			p := src.Pix[i : i+4]
+			if samePixel(p, shown.Pix[i:i+4]) {
+				continue
+			}
+			c := color.RGBA{R: p[0], G: p[1], B: p[2], A: p[3]}
+			idx, ok := cache[c]
+			if !ok {
+				idx = uint8(palette.Index(c))
+				cache[c] = idx
+			}
+			dst.Pix[dst.PixOffset(x, y)] = idx
+		}
+	}
+	return dst
+}
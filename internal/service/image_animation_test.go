@@ -0,0 +1,201 @@
+package service
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"testing"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+)
+
+// playGIF renders every frame of g the way a viewer shows it, applying each
+// frame's disposal method before the next one is drawn.
+func playGIF(g *gif.GIF) []*image.RGBA {
+	screen := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	canvas := image.NewRGBA(screen)
+	frames := make([]*image.RGBA, 0, len(g.Image))
+	for i, frame := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(screen)
+			copy(previous.Pix, canvas.Pix)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		shot := image.NewRGBA(screen)
+		copy(shot.Pix, canvas.Pix)
+		frames = append(frames, shot)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return frames
+}
+
+func solidFrame(rect image.Rectangle, palette color.Palette, idx uint8) *image.Paletted {
+	frame := image.NewPaletted(rect, palette)
+	for i := range frame.Pix {
+		frame.Pix[i] = idx
+	}
+	return frame
+}
+
+func TestCompositeAnimationPlayback(t *testing.T) {
+	transparent := color.RGBA{}
+	red := color.RGBA{R: 220, A: 255}
+	green := color.RGBA{G: 200, A: 255}
+	blue := color.RGBA{B: 210, A: 255}
+	yellow := color.RGBA{R: 230, G: 220, A: 255}
+	paletteA := color.Palette{transparent, red, blue}
+	paletteB := color.Palette{green, yellow, transparent}
+
+	// A backdrop, then sprites that jump around the screen with every kind of
+	// disposal, each smaller than the QR's bounding box with the previous one.
+	anim := &gif.GIF{
+		Image: []*image.Paletted{
+			solidFrame(image.Rect(0, 0, 400, 300), paletteA, 2),
+			solidFrame(image.Rect(0, 0, 40, 40), paletteA, 1),
+			solidFrame(image.Rect(150, 120, 190, 160), paletteB, 0),
+			solidFrame(image.Rect(60, 10, 90, 40), paletteB, 1),
+			solidFrame(image.Rect(5, 5, 15, 15), paletteB, 2),
+			solidFrame(image.Rect(100, 200, 130, 230), paletteA, 1),
+		},
+		Delay:     []int{10, 10, 10, 10, 10, 10},
+		Disposal:  []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious, gif.DisposalBackground, gif.DisposalNone, gif.DisposalBackground},
+		LoopCount: 0,
+		Config:    image.Config{Width: 400, Height: 300},
+	}
+
+	s := &QRCampaignService{baseURL: "https://qr.example", verifyMode: QRVerifyStrict}
+	campaign := &domain.QRCampaign{ShortCode: "abcd2345", RenderOptions: DefaultRenderOptions()}
+	overlay := DefaultOverlayOptions()
+	sizeRatio := 0.4
+	overlay.SizeRatio = &sizeRatio
+
+	result, err := s.compositeAnimation(campaign, anim, overlay, OutputOptions{})
+	if err != nil {
+		t.Fatalf("compositeAnimation: %v", err)
+	}
+	decoded, err := gif.DecodeAll(bytes.NewReader(result.Data))
+	if err != nil {
+		t.Fatalf("decoding output: %v", err)
+	}
+	if len(decoded.Image) != len(anim.Image) {
+		t.Fatalf("got %d frames, want %d", len(decoded.Image), len(anim.Image))
+	}
+
+	first := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	draw.Draw(first, anim.Image[0].Bounds(), anim.Image[0], image.Point{}, draw.Over)
+	layer, err := s.newOverlayLayer(campaign, first, overlay, 0)
+	if err != nil {
+		t.Fatalf("newOverlayLayer: %v", err)
+	}
+	want := playGIF(anim)
+	for _, frame := range want {
+		layer.drawOn(frame)
+	}
+
+	got := playGIF(decoded)
+	for i := range want {
+		b := want[i].Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				o := want[i].PixOffset(x, y)
+				if !samePixel(got[i].Pix[o:o+4], want[i].Pix[o:o+4]) {
+					t.Fatalf("frame %d pixel (%d,%d) = %v, want %v", i, x, y, got[i].At(x, y), want[i].At(x, y))
+				}
+			}
+		}
+	}
+}
+
+func encodeGIF(t *testing.T, anim *gif.GIF) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestScanGIF(t *testing.T) {
+	local := []color.Palette{
+		{color.Black, color.White},
+		{color.RGBA{R: 255, A: 255}, color.RGBA{G: 255, A: 255}, color.RGBA{B: 255, A: 255}},
+		make(color.Palette, 256),
+	}
+	for i := range local[2] {
+		local[2][i] = color.Gray{Y: uint8(i)}
+	}
+	// Each frame has its own palette, so each gets a local color table of a
+	// different size; the loop count adds an application extension and the
+	// delays graphic control extensions.
+	withLocal := &gif.GIF{LoopCount: 2, Config: image.Config{Width: 30, Height: 20}}
+	for i, p := range local {
+		withLocal.Image = append(withLocal.Image, solidFrame(image.Rect(i, i, 10+i, 10+i), p, 1))
+		withLocal.Delay = append(withLocal.Delay, 5)
+	}
+	// A global color table and no extensions
+	global := &gif.GIF{
+		Image:  []*image.Paletted{solidFrame(image.Rect(0, 0, 7, 3), local[1], 2)},
+		Delay:  []int{0},
+		Config: image.Config{ColorModel: local[1], Width: 7, Height: 3},
+	}
+
+	tests := []struct {
+		name         string
+		data         []byte
+		frames, w, h int
+	}{
+		{"local color tables", encodeGIF(t, withLocal), 3, 30, 20},
+		{"global color table", encodeGIF(t, global), 1, 7, 3},
+	}
+	for _, tt := range tests {
+		frames, w, h, err := scanGIF(tt.data)
+		if err != nil || frames != tt.frames || w != tt.w || h != tt.h {
+			t.Errorf("%s: scanGIF = %d frames %dx%d, %v; want %d frames %dx%d", tt.name, frames, w, h, err, tt.frames, tt.w, tt.h)
+		}
+		anim, err := gif.DecodeAll(bytes.NewReader(tt.data))
+		if err != nil || len(anim.Image) != tt.frames {
+			t.Errorf("%s: stdlib decoder disagrees: %v", tt.name, err)
+		}
+	}
+
+	valid := encodeGIF(t, withLocal)
+	// Truncations may report fewer frames, but never more and never panic
+	for n := 0; n < len(valid); n++ {
+		if frames, _, _, err := scanGIF(valid[:n]); err == nil && frames > 3 {
+			t.Errorf("truncated to %d bytes: %d frames", n, frames)
+		}
+	}
+
+	header := append([]byte("GIF89a"), 1, 0, 1, 0, 0, 0, 0)
+	malformed := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"not a GIF", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x00\x00")},
+		{"short header", header[:12]},
+		{"unknown block", append(bytes.Clone(header), 0x99)},
+		{"truncated image descriptor", append(bytes.Clone(header), 0x2c, 0, 0, 0, 0)},
+		{"local color table past the end", append(bytes.Clone(header), 0x2c, 0, 0, 0, 0, 1, 0, 1, 0, 0x87, 2)},
+		{"sub-block past the end", append(bytes.Clone(header), 0x2c, 0, 0, 0, 0, 1, 0, 1, 0, 0, 2, 200, 1)},
+		{"unterminated extension", append(bytes.Clone(header), 0x21, 0xf9, 4, 0, 0, 0, 0)},
+	}
+	for _, tt := range malformed {
+		if _, _, _, err := scanGIF(tt.data); err == nil {
+			t.Errorf("%s: scanGIF accepted malformed data", tt.name)
+		}
+	}
+}
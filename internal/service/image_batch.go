@@ -0,0 +1,233 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strings"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+)
+
+const batchManifestName = "manifest.json"
+
+var ErrInvalidBatch = errors.New("invalid batch")
+
+var zipMagic = []byte("PK\x03\x04")
+
+// BatchImage is one uploaded file of a batch: an image, or a ZIP of images.
+// Files are read in place, so uploads spooled to disk stay there.
+type BatchImage struct {
+	Name string
+	File io.ReaderAt
+	Size int64
+}
+
+type batchManifest struct {
+	CampaignID string               `json:"campaign_id"`
+	Processed  int                  `json:"processed"`
+	Failed     int                  `json:"failed"`
+	Files      []batchManifestEntry `json:"files"`
+}
+
+type batchManifestEntry struct {
+	Name     string `json:"name"`
+	Output   string `json:"output,omitempty"`
+	Position string `json:"position,omitempty"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Warning  string `json:"warning,omitempty"`
+}
+
+// batchFile is an image of a batch, read only when it is processed. err is
+// set when the file was rejected up front; it is reported instead of failing
+// the batch.
+type batchFile struct {
+	name string
+	open func() (io.ReadCloser, error)
+	err  error
+}
+
+// ProcessBatch overlays the active campaign QR on every image and writes a
+// ZIP of the results under their original names plus manifest.json, which
+// lists the outcome of each file. The batch is checked first and start is
+// only called once it is accepted, so earlier errors can still be reported
+// as a normal response; the ZIP is then streamed to the writer start
+// returns. Files are read and processed one at a time through the pool, so a
+// batch holds one image in memory and never takes more than one slot.
+func (s *QRCampaignService) ProcessBatch(ctx context.Context, images []BatchImage, overlay OverlayOptions, output OutputOptions, start func() io.Writer) error {
+	campaign, overlay, output, err := s.prepareProcessing(overlay, output)
+	if err != nil {
+		return err
+	}
+
+	files, err := s.limits.readBatch(images)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(start())
+	manifest := batchManifest{CampaignID: campaign.ID, Files: make([]batchManifestEntry, 0, len(files))}
+	names := map[string]bool{batchManifestName: true}
+
+	for _, f := range files {
+		entry := batchManifestEntry{Name: f.name, Status: "ok"}
+
+		var result *ProcessedImage
+		err := f.err
+		if err == nil {
+			result, err = s.processBatchFile(ctx, campaign, f, overlay, output)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			entry.Status = "error"
+			entry.Error = err.Error()
+			manifest.Failed++
+			manifest.Files = append(manifest.Files, entry)
+			continue
+		}
+
+		entry.Output = uniqueName(names, outputName(f.name, result.Format))
+		entry.Position = result.Position
+		entry.Warning = result.Warning
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: entry.Output, Method: zip.Store})
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(result.Data); err != nil {
+			return err
+		}
+		manifest.Processed++
+		manifest.Files = append(manifest.Files, entry)
+	}
+
+	w, err := zw.Create(batchManifestName)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func (s *QRCampaignService) processBatchFile(ctx context.Context, campaign *domain.QRCampaign, f batchFile, overlay OverlayOptions, output OutputOptions) (*ProcessedImage, error) {
+	rc, err := f.open()
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	data, err := s.limits.readImage(rc)
+	rc.Close()
+	if err != nil {
+		return nil, err
+	}
+	return s.runProcessing(ctx, campaign, data, overlay, output)
+}
+
+// readBatch lists the images of a batch, expanding ZIP archives, without
+// reading them. Their total size, with ZIP entries counted decompressed, must
+// stay within MaxBatchBytes; the sizes in ZIP headers can be trusted, as
+// archive/zip fails an entry that inflates past its declared size. Files over
+// the per-image limit are rejected individually and not counted.
+func (l ImageLimits) readBatch(images []BatchImage) ([]batchFile, error) {
+	var files []batchFile
+	var total int64
+	add := func(f batchFile, size int64) error {
+		if len(files) >= l.MaxBatchFiles {
+			return fmt.Errorf("%w: at most %d images per batch", ErrInvalidBatch, l.MaxBatchFiles)
+		}
+		if size > l.MaxBytes {
+			f.err = fmt.Errorf("%w: upload exceeds %d bytes", ErrImageTooLarge, l.MaxBytes)
+		} else if total += size; total > l.MaxBatchBytes {
+			return fmt.Errorf("%w: batch exceeds %d bytes", ErrImageTooLarge, l.MaxBatchBytes)
+		}
+		files = append(files, f)
+		return nil
+	}
+
+	for _, img := range images {
+		magic := make([]byte, len(zipMagic))
+		if n, _ := img.File.ReadAt(magic, 0); n < len(magic) || !bytes.Equal(magic, zipMagic) {
+			section := io.NewSectionReader(img.File, 0, img.Size)
+			f := batchFile{name: img.Name, open: func() (io.ReadCloser, error) { return io.NopCloser(section), nil }}
+			if err := add(f, img.Size); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		zr, err := zip.NewReader(img.File, img.Size)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s is not a valid zip archive", ErrInvalidBatch, img.Name)
+		}
+		for _, zf := range zr.File {
+			if !isBatchImageEntry(zf.Name) {
+				continue
+			}
+			f := batchFile{name: zf.Name, open: zf.Open}
+			if err := add(f, int64(min(zf.UncompressedSize64, math.MaxInt64))); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%w: no images found", ErrInvalidBatch)
+	}
+	return files, nil
+}
+
+// isBatchImageEntry skips directories and the metadata files archivers add
+func isBatchImageEntry(name string) bool {
+	if strings.HasSuffix(name, "/") || strings.HasPrefix(name, "__MACOSX/") {
+		return false
+	}
+	return !strings.HasPrefix(path.Base(name), ".")
+}
+
+var formatExtensions = map[string][]string{
+	ImageFormatPNG:  {".png"},
+	ImageFormatJPEG: {".jpg", ".jpeg", ".jpe"},
+	ImageFormatGIF:  {".gif"},
+	ImageFormatBMP:  {".bmp"},
+	ImageFormatTIFF: {".tiff", ".tif"},
+}
+
+// outputName keeps the file's base name (directories are dropped, so entries
+// cannot escape the archive) and only swaps the extension when the output
+// format differs from it.
+func outputName(name, format string) string {
+	base := path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if base == "." || base == "/" {
+		base = "image"
+	}
+	ext := path.Ext(base)
+	for _, e := range formatExtensions[format] {
+		if strings.EqualFold(ext, e) {
+			return base
+		}
+	}
+	return strings.TrimSuffix(base, ext) + formatExtensions[format][0]
+}
+
+// uniqueName appends " (2)", " (3)", ... until name is unused
+func uniqueName(used map[string]bool, name string) string {
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 2; used[strings.ToLower(candidate)]; i++ {
+		candidate = fmt.Sprintf("%s (%d)%s", stem, i, ext)
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"testing"
+)
+
+// testZip deflates files into a ZIP archive
+func testZip(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// blankPNG is an uncompressed PNG of a single color, which deflates to a
+// fraction of its size inside a ZIP
+func blankPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	enc := png.Encoder{CompressionLevel: png.NoCompression}
+	if err := enc.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func batchUpload(name string, data []byte) BatchImage {
+	return BatchImage{Name: name, File: bytes.NewReader(data), Size: int64(len(data))}
+}
+
+func TestReadBatchLimits(t *testing.T) {
+	limits := ImageLimits{MaxBytes: 1 << 20, MaxBatchBytes: 2 << 20, MaxBatchFiles: 10}
+	// Each entry is under the per-image limit but four of them inflate past
+	// the batch limit
+	entry := blankPNG(t, 900, 900)
+	bomb := testZip(t, map[string][]byte{"a.png": entry, "b.png": entry, "c.png": entry, "d.png": entry})
+	if len(bomb) >= len(entry) {
+		t.Fatalf("zip is %d bytes, want it smaller than one entry (%d)", len(bomb), len(entry))
+	}
+
+	_, err := limits.readBatch([]BatchImage{batchUpload("album.zip", bomb)})
+	if !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("decompressed size over the limit: err = %v, want ErrImageTooLarge", err)
+	}
+
+	large := blankPNG(t, 1100, 1100)
+	files, err := limits.readBatch([]BatchImage{batchUpload("album.zip", testZip(t, map[string][]byte{"large.png": large, "ok.png": entry}))})
+	if err != nil {
+		t.Fatalf("oversized entry failed the batch: %v", err)
+	}
+	for _, f := range files {
+		if gotErr := errors.Is(f.err, ErrImageTooLarge); gotErr != (f.name == "large.png") {
+			t.Errorf("%s: err = %v", f.name, f.err)
+		}
+	}
+
+	limits.MaxBatchBytes, limits.MaxBatchFiles = 8<<20, 3
+	_, err = limits.readBatch([]BatchImage{batchUpload("album.zip", bomb)})
+	if !errors.Is(err, ErrInvalidBatch) {
+		t.Errorf("too many files: err = %v, want ErrInvalidBatch", err)
+	}
+
+	_, err = limits.readBatch([]BatchImage{batchUpload("album.zip", testZip(t, map[string][]byte{"__MACOSX/._a.png": entry, "trip/": nil}))})
+	if !errors.Is(err, ErrInvalidBatch) {
+		t.Errorf("no images: err = %v, want ErrInvalidBatch", err)
+	}
+}
+
+func TestProcessBatchRejectsBeforeStreaming(t *testing.T) {
+	s := newTestService(&fakeCampaignRepo{})
+	s.cached = testCampaign("c")
+	entry := blankPNG(t, 900, 900)
+	bomb := testZip(t, map[string][]byte{"a.png": entry, "b.png": entry, "c.png": entry, "d.png": entry, "e.png": entry, "f.png": entry})
+
+	started := false
+	err := s.ProcessBatch(context.Background(), []BatchImage{batchUpload("album.zip", bomb)}, OverlayOptions{}, OutputOptions{}, func() io.Writer {
+		started = true
+		return io.Discard
+	})
+	if !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("err = %v, want ErrImageTooLarge", err)
+	}
+	if started {
+		t.Error("response started before the batch was rejected")
+	}
+}
+
+func TestProcessBatch(t *testing.T) {
+	s := newTestService(&fakeCampaignRepo{})
+	s.cached = testCampaign("c")
+	photo := testPhoto(t, 600, 400)
+	images := []BatchImage{
+		batchUpload("photo.png", photo),
+		batchUpload("album.zip", testZip(t, map[string][]byte{"trip/photo.png": photo, "broken.png": []byte("not an image")})),
+	}
+
+	var out bytes.Buffer
+	if err := s.ProcessBatch(context.Background(), images, OverlayOptions{}, OutputOptions{}, func() io.Writer { return &out }); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatalf("output is not a valid zip: %v", err)
+	}
+	entries := map[string]*zip.File{}
+	for _, f := range zr.File {
+		entries[f.Name] = f
+	}
+	for _, name := range []string{"photo.png", "photo (2).png", batchManifestName} {
+		if entries[name] == nil {
+			t.Errorf("output is missing %s", name)
+		}
+	}
+
+	rc, err := entries[batchManifestName].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	var manifest batchManifest
+	if err := json.NewDecoder(rc).Decode(&manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Processed != 2 || manifest.Failed != 1 {
+		t.Errorf("manifest: processed %d, failed %d, want 2 and 1", manifest.Processed, manifest.Failed)
+	}
+	for _, f := range manifest.Files {
+		if (f.Status == "error") != (f.Name == "broken.png") {
+			t.Errorf("%s: status %q, error %q", f.Name, f.Status, f.Error)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"image"
+	"math"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// smartCrop crops src to the aspect ratio of width x height and scales it to
+// exactly that size. The crop only moves along the axis that is too long, and
+// it is placed where the most edges are (see sobelEdges) rather than in the
+// middle, so the subject of a photo stays in frame.
+func smartCrop(src image.Image, width, height int) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	crop := image.Rect(0, 0, w, h)
+	if w*height > h*width {
+		cw := max(1, int(math.Round(float64(h)*float64(width)/float64(height))))
+		crop = image.Rect(0, 0, cw, h)
+	} else if w*height < h*width {
+		ch := max(1, int(math.Round(float64(w)*float64(height)/float64(width))))
+		crop = image.Rect(0, 0, w, ch)
+	}
+	if crop.Dx() < w || crop.Dy() < h {
+		crop = crop.Add(detailOffset(src, crop.Dx(), crop.Dy()))
+	}
+	crop = crop.Add(bounds.Min)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, xdraw.Src, nil)
+	return dst
+}
+
+// detailOffset returns where a cw x ch window over src covers the most edge
+// pixels. Ties go to the position closest to the center.
+func detailOffset(src image.Image, cw, ch int) image.Point {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	gray, scale := analysisImage(src)
+	edges := sobelEdges(gray)
+	gw, gh := gray.Rect.Dx(), gray.Rect.Dy()
+
+	horizontal := cw < w
+	// Edge count per column (or row) along the axis the window slides on
+	n := gh
+	if horizontal {
+		n = gw
+	}
+	profile := make([]int, n+1)
+	for y := 0; y < gh; y++ {
+		for x := 0; x < gw; x++ {
+			if edges[y*gw+x] {
+				i := y
+				if horizontal {
+					i = x
+				}
+				profile[i+1]++
+			}
+		}
+	}
+	for i := 1; i <= n; i++ {
+		profile[i] += profile[i-1]
+	}
+
+	window, free := ch, h-ch
+	if horizontal {
+		window, free = cw, w-cw
+	}
+	length := min(n, max(1, int(math.Round(float64(window)*scale))))
+	center := float64(n-length) / 2
+	best, bestSum := 0, -1
+	for i := 0; i+length <= n; i++ {
+		sum := profile[i+length] - profile[i]
+		if sum > bestSum || (sum == bestSum && math.Abs(float64(i)-center) < math.Abs(float64(best)-center)) {
+			best, bestSum = i, sum
+		}
+	}
+
+	offset := min(free, max(0, int(math.Round(float64(best)/scale))))
+	if horizontal {
+		return image.Pt(offset, 0)
+	}
+	return image.Pt(0, offset)
+}
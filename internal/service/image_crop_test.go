@@ -0,0 +1,79 @@
+package service
+
+import (
+	"image"
+	"testing"
+)
+
+func TestDetailOffset(t *testing.T) {
+	tests := []struct {
+		name   string
+		w, h   int
+		busy   []image.Rectangle
+		cw, ch int
+		want   image.Point
+	}{
+		{"uniform landscape is centered", 800, 600, nil, 600, 600, image.Pt(100, 0)},
+		{"detail on the left", 800, 600, []image.Rectangle{image.Rect(0, 0, 400, 300)}, 600, 600, image.Pt(0, 0)},
+		{"detail on the right", 800, 600, []image.Rectangle{image.Rect(400, 300, 800, 600)}, 600, 600, image.Pt(200, 0)},
+		{"uniform portrait is centered", 600, 800, nil, 600, 450, image.Pt(0, 175)},
+		{"detail at the top", 600, 800, []image.Rectangle{image.Rect(300, 0, 600, 300)}, 600, 450, image.Pt(0, 0)},
+		{"detail at the bottom", 600, 800, []image.Rectangle{image.Rect(0, 500, 300, 800)}, 600, 450, image.Pt(0, 350)},
+	}
+	// The analysis image is 256 pixels long, so offsets are found to within
+	// about 3 pixels here
+	const tolerance = 4
+	for _, tt := range tests {
+		got := detailOffset(busyImage(tt.w, tt.h, tt.busy...), tt.cw, tt.ch)
+		if d := got.Sub(tt.want); abs(d.X) > tolerance || abs(d.Y) > tolerance {
+			t.Errorf("%s: offset %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// darkPixels counts the checkerboard pixels of busyImage in r
+func darkPixels(img image.Image, r image.Rectangle) int {
+	n := 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if r, _, _, _ := img.At(x, y).RGBA(); r < 0x4000 {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func TestSmartCrop(t *testing.T) {
+	// A centered crop (250-550) would miss the detail along the right edge
+	src := busyImage(800, 600, image.Rect(600, 0, 800, 300))
+
+	tests := []struct {
+		name string
+		src  image.Image
+	}{
+		{"image", src},
+		{"sub-image", src.SubImage(image.Rect(0, 0, 800, 600))},
+		{"offset sub-image", busyImage(1000, 700, image.Rect(700, 100, 900, 400)).SubImage(image.Rect(100, 100, 900, 700))},
+	}
+	for _, tt := range tests {
+		dst := smartCrop(tt.src, 150, 300)
+		if got := dst.Bounds(); got != image.Rect(0, 0, 150, 300) {
+			t.Errorf("%s: bounds %v, want 150x300", tt.name, got)
+			continue
+		}
+		// The detail fills the top half on the right of the crop
+		if n := darkPixels(dst, image.Rect(75, 0, 150, 150)); n < 75*150/4 {
+			t.Errorf("%s: %d dark pixels in the top right, want the detail", tt.name, n)
+		}
+		if n := darkPixels(dst, image.Rect(0, 160, 150, 300)); n > 0 {
+			t.Errorf("%s: %d dark pixels in the bottom half, want none", tt.name, n)
+		}
+	}
+
+	// Matching aspect ratios are only scaled
+	dst := smartCrop(src, 400, 300)
+	if n := darkPixels(dst, image.Rect(0, 0, 290, 300)); n > 0 {
+		t.Errorf("scaled image has %d dark pixels left of the detail", n)
+	}
+}
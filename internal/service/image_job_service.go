@@ -0,0 +1,267 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/config"
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+)
+
+const (
+	jobRetryBaseDelay = 10 * time.Second
+	jobRetryMaxDelay  = 10 * time.Minute
+	// A running job not finished within this time is assumed to belong to a
+	// crashed worker and is claimed again
+	jobStaleAfter = 5 * time.Minute
+)
+
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobNotReady = errors.New("job result not ready")
+)
+
+// ImageJobService runs process-image requests in the background. Jobs live in
+// Postgres, so any server process can pick them up; results are kept until
+// the retention period ends.
+type ImageJobService struct {
+	repo         domain.ImageJobRepository
+	campaigns    *QRCampaignService
+	workers      int
+	pollInterval time.Duration
+	maxAttempts  int
+	retention    time.Duration
+	wg           sync.WaitGroup
+}
+
+// jobOptions is stored with each job; both parts are already merged and
+// validated when the job is created. The JSON keys must stay stable, as jobs
+// may be queued across deploys.
+type jobOptions struct {
+	Overlay OverlayOptions `json:"overlay"`
+	Output  OutputOptions  `json:"output"`
+}
+
+func NewImageJobService(repo domain.ImageJobRepository, campaigns *QRCampaignService, cfg *config.Config) *ImageJobService {
+	return &ImageJobService{
+		repo:         repo,
+		campaigns:    campaigns,
+		workers:      cfg.JobWorkers,
+		pollInterval: cfg.JobPollInterval,
+		maxAttempts:  cfg.JobMaxAttempts,
+		retention:    cfg.JobRetention,
+	}
+}
+
+// Enqueue checks the upload and options the same way ProcessImage does and
+// stores a job for the currently active campaign.
+func (s *ImageJobService) Enqueue(userID string, uploadedImage io.Reader, overlay OverlayOptions, output OutputOptions) (*domain.ImageJob, error) {
+	campaign, overlay, output, err := s.campaigns.prepareProcessing(overlay, output)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.campaigns.limits.readImage(uploadedImage)
+	if err != nil {
+		return nil, err
+	}
+
+	options, err := json.Marshal(jobOptions{Overlay: overlay, Output: output})
+	if err != nil {
+		return nil, err
+	}
+
+	job := &domain.ImageJob{
+		UserID:      userID,
+		CampaignID:  campaign.ID,
+		Options:     options,
+		InputData:   data,
+		MaxAttempts: s.maxAttempts,
+	}
+	if err := s.repo.Create(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// GetJob returns a job owned by userID; admins can see every job.
+func (s *ImageJobService) GetJob(id, userID string, admin bool) (*domain.ImageJob, error) {
+	job, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil || (!admin && job.UserID != userID) {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// GetResult returns the output of a succeeded job.
+func (s *ImageJobService) GetResult(id, userID string, admin bool) (*ProcessedImage, error) {
+	job, err := s.GetJob(id, userID, admin)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != domain.ImageJobSucceeded {
+		return nil, ErrJobNotReady
+	}
+
+	data, contentType, err := s.repo.FindResult(id)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, ErrJobNotReady
+	}
+	return &ProcessedImage{Data: data, ContentType: contentType, Warning: job.Warning}, nil
+}
+
+// Start launches the workers. They stop claiming jobs when ctx is cancelled;
+// call Wait to let running jobs finish.
+func (s *ImageJobService) Start(ctx context.Context) {
+	for i := 0; i < s.workers; i++ {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.work(ctx)
+		}()
+	}
+}
+
+func (s *ImageJobService) Wait() {
+	s.wg.Wait()
+}
+
+// PurgeExpiredJobs deletes finished jobs past their retention period
+func (s *ImageJobService) PurgeExpiredJobs() error {
+	deleted, err := s.repo.DeleteExpired(time.Now())
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		log.Printf("[INFO] purged %d expired image jobs", deleted)
+	}
+	return nil
+}
+
+func (s *ImageJobService) work(ctx context.Context) {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain every due job before sleeping again
+		for ctx.Err() == nil && s.runNext(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNext claims and runs one job. It reports whether a job was found.
+func (s *ImageJobService) runNext(ctx context.Context) bool {
+	now := time.Now()
+	job, err := s.repo.Claim(now, now.Add(-jobStaleAfter))
+	if err != nil {
+		log.Printf("[ERROR] ImageJob claim: %v", err)
+		return false
+	}
+	if job == nil {
+		return false
+	}
+
+	s.run(ctx, job)
+	return true
+}
+
+func (s *ImageJobService) run(ctx context.Context, job *domain.ImageJob) {
+	var result *ProcessedImage
+	err := fmt.Errorf("exceeded %d attempts", job.MaxAttempts)
+	if job.Attempts <= job.MaxAttempts {
+		result, err = s.process(ctx, job)
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.retention)
+	switch {
+	case err == nil:
+		err = s.repo.Complete(job.ID, result.Data, result.ContentType, result.Warning, now, expiresAt)
+	case errors.Is(err, ErrServerBusy) || ctx.Err() != nil:
+		// Not the job's fault, so the attempt is not counted
+		err = s.repo.Retry(job.ID, "", now, now.Add(s.pollInterval), false)
+	case isPermanentJobError(err) || job.Attempts >= job.MaxAttempts:
+		log.Printf("[WARN] image job %s failed after %d attempts: %v", job.ID, job.Attempts, err)
+		err = s.repo.Fail(job.ID, err.Error(), now, expiresAt)
+	default:
+		log.Printf("[WARN] image job %s attempt %d failed, retrying: %v", job.ID, job.Attempts, err)
+		err = s.repo.Retry(job.ID, err.Error(), now, now.Add(jobRetryDelay(job.Attempts)), true)
+	}
+	if err != nil {
+		log.Printf("[ERROR] ImageJob %s update: %v", job.ID, err)
+	}
+}
+
+func (s *ImageJobService) process(ctx context.Context, job *domain.ImageJob) (*ProcessedImage, error) {
+	var opts jobOptions
+	if err := json.Unmarshal(job.Options, &opts); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOutput, err)
+	}
+
+	campaign, err := s.campaigns.repo.FindByID(job.CampaignID)
+	if err != nil {
+		return nil, err
+	}
+	if campaign == nil {
+		return nil, ErrCampaignNotFound
+	}
+	// The campaign may have ended while the job was queued; ProcessImage
+	// would reject the request by now
+	if campaign.IsExpired(time.Now()) {
+		return nil, ErrCampaignExpired
+	}
+	if !campaign.IsActive {
+		return nil, fmt.Errorf("%w: campaign is no longer active", ErrCampaignNotFound)
+	}
+
+	output := opts.Output
+	if output.TemplateID != "" {
+		if output, err = s.campaigns.resolveTemplate(output); err != nil {
+			return nil, err
+		}
+	}
+
+	// Jobs queued before an option existed leave it unset
+	overlay := opts.Overlay.merge(DefaultOverlayOptions())
+	return s.campaigns.runProcessing(ctx, campaign, job.InputData, overlay, output)
+}
+
+// jobRetryDelay doubles the delay after each failed attempt
+func jobRetryDelay(attempts int) time.Duration {
+	delay := jobRetryBaseDelay
+	for i := 1; i < attempts && delay < jobRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, jobRetryMaxDelay)
+}
+
+// isPermanentJobError reports errors that would fail again on retry
+func isPermanentJobError(err error) bool {
+	for _, target := range []error{
+		ErrCampaignNotFound, ErrCampaignExpired, ErrInvalidImage, ErrImageTooLarge, ErrInvalidOverlay,
+		ErrInvalidOutput, ErrInvalidRenderOptions, ErrInvalidLogo, ErrQRUnreadable,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
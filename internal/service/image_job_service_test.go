@@ -0,0 +1,114 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+)
+
+func TestProcessJobChecksCampaign(t *testing.T) {
+	var buf bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	for i := range img.Pix {
+		img.Pix[i] = 200
+	}
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	options, err := json.Marshal(jobOptions{Overlay: DefaultOverlayOptions(), Output: OutputOptions{Format: ImageFormatPNG}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	active := testCampaign("active")
+	inactive := testCampaign("inactive")
+	inactive.IsActive = false
+	expired := testCampaign("expired")
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	repo := &fakeCampaignRepo{campaigns: map[string]*domain.QRCampaign{
+		active.ID: active, inactive.ID: inactive, expired.ID: expired,
+	}}
+	s := &ImageJobService{campaigns: newTestService(repo)}
+
+	tests := []struct {
+		campaignID string
+		want       error
+	}{
+		{"active", nil},
+		{"inactive", ErrCampaignNotFound},
+		{"expired", ErrCampaignExpired},
+		{"deleted", ErrCampaignNotFound},
+	}
+	for _, tt := range tests {
+		job := &domain.ImageJob{CampaignID: tt.campaignID, Options: options, InputData: buf.Bytes()}
+		result, err := s.process(context.Background(), job)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.campaignID, err, tt.want)
+			continue
+		}
+		if tt.want == nil {
+			if _, err := png.Decode(bytes.NewReader(result.Data)); err != nil {
+				t.Errorf("%s: output does not decode: %v", tt.campaignID, err)
+			}
+		} else if !isPermanentJobError(err) {
+			t.Errorf("%s: %v would be retried", tt.campaignID, err)
+		}
+	}
+}
+
+// Stored jobs must keep decoding after the option structs change, so the
+// JSON keys are pinned here.
+func TestJobOptionsKeys(t *testing.T) {
+	stored := `{
+		"overlay": {"position": "custom", "x": {"value": 25, "percent": true}, "y": {"value": 40},
+			"size_ratio": 0.3, "padding": 12, "opacity": 0.9, "plate_color": "#ffffff", "plate_opacity": 0.5,
+			"plate_radius": 0.2, "caption": "Scan", "caption_color": "#000000", "resample": "smooth", "print_size": 25},
+		"output": {"format": "jpeg", "quality": 80, "keep_metadata": true, "preset": "x-post", "width": 1600,
+			"height": 900, "template_id": "t1", "dpi": 300, "verify": "strict"}
+	}`
+	var opts jobOptions
+	if err := json.Unmarshal([]byte(stored), &opts); err != nil {
+		t.Fatal(err)
+	}
+
+	o := opts.Overlay
+	switch {
+	case o.Position != OverlayCustom,
+		o.X == nil || *o.X != (Coordinate{Value: 25, Percent: true}),
+		o.Y == nil || *o.Y != (Coordinate{Value: 40}),
+		o.SizeRatio == nil || *o.SizeRatio != 0.3,
+		o.Padding == nil || *o.Padding != 12,
+		o.Opacity == nil || *o.Opacity != 0.9,
+		o.PlateColor == nil || *o.PlateColor != "#ffffff",
+		o.PlateOpacity == nil || *o.PlateOpacity != 0.5,
+		o.PlateRadius == nil || *o.PlateRadius != 0.2,
+		o.Caption == nil || *o.Caption != "Scan",
+		o.CaptionColor == nil || *o.CaptionColor != "#000000",
+		o.Resample == nil || *o.Resample != "smooth",
+		o.PrintSize == nil || *o.PrintSize != 25:
+		t.Errorf("overlay decoded as %+v", o)
+	}
+	want := OutputOptions{
+		Format: "jpeg", Quality: 80, KeepMetadata: true, Preset: "x-post", Width: 1600, Height: 900,
+		TemplateID: "t1", DPI: 300, Verify: "strict",
+	}
+	if opts.Output != want {
+		t.Errorf("output decoded as %+v, want %+v", opts.Output, want)
+	}
+
+	// Unset options stay unset, so defaults added later still apply
+	data, err := json.Marshal(jobOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"overlay":{},"output":{}}` {
+		t.Errorf("empty options encoded as %s", data)
+	}
+}
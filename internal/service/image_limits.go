@@ -0,0 +1,68 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/config"
+)
+
+var ErrImageTooLarge = errors.New("image too large")
+
+// ImageLimits bounds what process-image accepts, so a small compressed file
+// cannot expand into gigabytes of pixels. The batch limits apply to a whole
+// batch request; each file in it must still meet the per-image limits.
+type ImageLimits struct {
+	MaxBytes      int64
+	MaxDimension  int
+	MaxMegapixels float64
+	MaxBatchFiles int
+	MaxBatchBytes int64
+	// Frames times canvas size, checked before an animated GIF is decoded
+	MaxAnimationMegapixels float64
+}
+
+func newImageLimits(cfg *config.Config) ImageLimits {
+	return ImageLimits{
+		MaxBytes:               cfg.MaxUploadBytes,
+		MaxDimension:           cfg.MaxImageDimension,
+		MaxMegapixels:          cfg.MaxImageMegapixels,
+		MaxBatchFiles:          cfg.MaxBatchFiles,
+		MaxBatchBytes:          cfg.MaxBatchBytes,
+		MaxAnimationMegapixels: cfg.MaxAnimationMegapixels,
+	}
+}
+
+// readImage reads an upload of at most MaxBytes and checks its header
+// against the pixel limits before anything is fully decoded.
+func (l ImageLimits) readImage(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, l.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > l.MaxBytes {
+		return nil, fmt.Errorf("%w: upload exceeds %d bytes", ErrImageTooLarge, l.MaxBytes)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if err := l.checkDimensions(cfg.Width, cfg.Height); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (l ImageLimits) checkDimensions(width, height int) error {
+	if width > l.MaxDimension || height > l.MaxDimension {
+		return fmt.Errorf("%w: %dx%d exceeds %d pixels per side", ErrImageTooLarge, width, height, l.MaxDimension)
+	}
+	if mp := float64(width) * float64(height) / 1e6; mp > l.MaxMegapixels {
+		return fmt.Errorf("%w: %.1f megapixels exceeds %g", ErrImageTooLarge, mp, l.MaxMegapixels)
+	}
+	return nil
+}
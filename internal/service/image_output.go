@@ -0,0 +1,203 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+	"github.com/IMPHNEN/imphnen-backend-qr/pkg/density"
+	"github.com/IMPHNEN/imphnen-backend-qr/pkg/exif"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+
+	// Registers the WebP decoder for image.Decode (there is no encoder)
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	ImageFormatPNG  = "png"
+	ImageFormatJPEG = "jpeg"
+	ImageFormatGIF  = "gif"
+	ImageFormatBMP  = "bmp"
+	ImageFormatTIFF = "tiff"
+
+	defaultJPEGQuality = 90
+)
+
+var ErrInvalidOutput = errors.New("invalid output options")
+
+var imageContentTypes = map[string]string{
+	ImageFormatPNG:  "image/png",
+	ImageFormatJPEG: "image/jpeg",
+	ImageFormatGIF:  "image/gif",
+	ImageFormatBMP:  "image/bmp",
+	ImageFormatTIFF: "image/tiff",
+}
+
+// OutputOptions selects how a processed image is encoded. An empty Format
+// keeps the input format; Quality (1-100) only applies to JPEG. EXIF metadata
+// (GPS, camera, ...) is stripped unless KeepMetadata is set. Preset names an
+// image preset; prepareProcessing resolves it into Width and Height, the size
+// the source is cropped and scaled to before the QR is placed. TemplateID
+// names a frame template, loaded into template before processing. DPI (72-2400)
+// is written into the output's resolution metadata and converts a physical
+// QR size to pixels; GIF has no resolution field, so it only sizes the QR.
+// Verify (warn or strict) makes the configured QR read-back mode stricter; it
+// cannot relax it.
+type OutputOptions struct {
+	Format       string `json:"format,omitempty"`
+	Quality      int    `json:"quality,omitempty"`
+	KeepMetadata bool   `json:"keep_metadata,omitempty"`
+	Preset       string `json:"preset,omitempty"`
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	TemplateID   string `json:"template_id,omitempty"`
+	DPI          int    `json:"dpi,omitempty"`
+	Verify       string `json:"verify,omitempty"`
+	template     *domain.FrameTemplate
+}
+
+type ProcessedImage struct {
+	Data        []byte
+	ContentType string
+	Format      string
+	// Position is where the QR was placed, with auto resolved
+	Position string
+	// Warning is set when the QR could not be read back in warn mode
+	Warning string
+}
+
+// ImageFormatForMediaType maps a media type such as "image/jpeg" to the
+// output format that produces it.
+func ImageFormatForMediaType(mediaType string) (string, bool) {
+	for format, contentType := range imageContentTypes {
+		if strings.EqualFold(contentType, mediaType) {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+func (o OutputOptions) normalize() (OutputOptions, error) {
+	o.Format = strings.ToLower(o.Format)
+	o.Preset = strings.ToLower(o.Preset)
+	if o.Format == "jpg" {
+		o.Format = ImageFormatJPEG
+	}
+	if _, ok := imageContentTypes[o.Format]; o.Format != "" && !ok {
+		return o, fmt.Errorf("%w: format must be one of png, jpeg, gif, bmp, tiff", ErrInvalidOutput)
+	}
+	if o.Quality == 0 {
+		o.Quality = defaultJPEGQuality
+	}
+	if o.Quality < 1 || o.Quality > 100 {
+		return o, fmt.Errorf("%w: quality must be between 1 and 100", ErrInvalidOutput)
+	}
+	if !validDPI(o.DPI) {
+		return o, fmt.Errorf("%w: dpi must be between %d and %d", ErrInvalidOutput, minDPI, maxDPI)
+	}
+	o.Verify = strings.ToLower(o.Verify)
+	if o.Verify != "" && o.Verify != QRVerifyWarn && o.Verify != QRVerifyStrict {
+		return o, fmt.Errorf("%w: verify must be warn or strict", ErrInvalidOutput)
+	}
+	return o, nil
+}
+
+var verifyStrictness = map[string]int{QRVerifyOff: 0, QRVerifyWarn: 1, QRVerifyStrict: 2}
+
+// verifyMode is the QR read-back mode for this request: the stricter of the
+// configured mode and Verify, so a client cannot skip a check the server
+// enforces.
+func (o OutputOptions) verifyMode(configured string) string {
+	if verifyStrictness[o.Verify] > verifyStrictness[configured] {
+		return o.Verify
+	}
+	return configured
+}
+
+// outputFormat picks the encoder for an image decoded as inputFormat. WebP
+// has no pure-Go encoder, so it becomes JPEG, or PNG when it has transparency.
+func (o OutputOptions) outputFormat(inputFormat string, src image.Image) string {
+	if o.Format != "" {
+		return o.Format
+	}
+	if _, ok := imageContentTypes[inputFormat]; ok {
+		return inputFormat
+	}
+	if isOpaque(src) {
+		return ImageFormatJPEG
+	}
+	return ImageFormatPNG
+}
+
+// encodeImage encodes img in format. JPEG has no alpha channel, so
+// transparent areas are flattened onto white first.
+func encodeImage(img image.Image, format string, quality int) (*ProcessedImage, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case ImageFormatPNG:
+		err = png.Encode(&buf, img)
+	case ImageFormatJPEG:
+		if !isOpaque(img) {
+			flat := image.NewRGBA(img.Bounds())
+			draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+			draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+			img = flat
+		}
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case ImageFormatGIF:
+		err = gif.Encode(&buf, img, nil)
+	case ImageFormatBMP:
+		err = bmp.Encode(&buf, img)
+	case ImageFormatTIFF:
+		err = tiff.Encode(&buf, img, &tiff.Options{Compression: tiff.Deflate})
+	default:
+		return nil, fmt.Errorf("%w: unsupported format %q", ErrInvalidOutput, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ProcessedImage{Data: buf.Bytes(), ContentType: imageContentTypes[format], Format: format}, nil
+}
+
+// attachExif embeds an EXIF block in the encoded image. Only JPEG and PNG
+// carry EXIF here; other formats are left unchanged.
+func (p *ProcessedImage) attachExif(tiff []byte) {
+	switch p.Format {
+	case ImageFormatJPEG:
+		p.Data = exif.InsertJPEG(p.Data, tiff)
+	case ImageFormatPNG:
+		p.Data = exif.InsertPNG(p.Data, tiff)
+	}
+}
+
+// setDensity records dpi in the encoded image's resolution metadata. The
+// JFIF segment must come first in a JPEG, so this runs after attachExif.
+func (p *ProcessedImage) setDensity(dpi int) {
+	switch p.Format {
+	case ImageFormatPNG:
+		p.Data = density.PNG(p.Data, dpi)
+	case ImageFormatJPEG:
+		p.Data = density.JPEG(p.Data, dpi)
+	case ImageFormatBMP:
+		p.Data = density.BMP(p.Data, dpi)
+	case ImageFormatTIFF:
+		p.Data = density.TIFF(p.Data, dpi)
+	}
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
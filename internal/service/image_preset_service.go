@@ -0,0 +1,116 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/config"
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+)
+
+const minPresetDimension = 32
+
+var (
+	ErrPresetNotFound = errors.New("preset not found")
+	ErrPresetExists   = errors.New("preset name already exists")
+	ErrInvalidPreset  = errors.New("invalid preset")
+)
+
+var presetNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,49}$`)
+
+// ImagePresetService manages the named output sizes process-image accepts as
+// its preset field.
+type ImagePresetService struct {
+	repo         domain.ImagePresetRepository
+	maxDimension int
+}
+
+// ImagePresetInput creates or updates a preset. On update, unset fields keep
+// their current value.
+type ImagePresetInput struct {
+	Name   string `json:"name"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+func NewImagePresetService(repo domain.ImagePresetRepository, cfg *config.Config) *ImagePresetService {
+	return &ImagePresetService{repo: repo, maxDimension: cfg.MaxImageDimension}
+}
+
+func (s *ImagePresetService) GetAllPresets() ([]*domain.ImagePreset, error) {
+	return s.repo.FindAll()
+}
+
+func (s *ImagePresetService) CreatePreset(input ImagePresetInput) (*domain.ImagePreset, error) {
+	preset := &domain.ImagePreset{}
+	if err := s.apply(preset, input); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(preset); err != nil {
+		return nil, err
+	}
+	return preset, nil
+}
+
+func (s *ImagePresetService) UpdatePreset(id string, input ImagePresetInput) (*domain.ImagePreset, error) {
+	preset, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if preset == nil {
+		return nil, ErrPresetNotFound
+	}
+
+	if err := s.apply(preset, input); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(preset); err != nil {
+		return nil, err
+	}
+	return preset, nil
+}
+
+func (s *ImagePresetService) DeletePreset(id string) error {
+	preset, err := s.repo.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if preset == nil {
+		return ErrPresetNotFound
+	}
+
+	return s.repo.Delete(id)
+}
+
+// apply validates input on top of preset and checks the name is not taken
+func (s *ImagePresetService) apply(preset *domain.ImagePreset, input ImagePresetInput) error {
+	if name := strings.ToLower(strings.TrimSpace(input.Name)); name != "" {
+		preset.Name = name
+	}
+	if input.Width != 0 {
+		preset.Width = input.Width
+	}
+	if input.Height != 0 {
+		preset.Height = input.Height
+	}
+
+	if !presetNamePattern.MatchString(preset.Name) {
+		return fmt.Errorf("%w: name must be 1-50 lowercase letters, digits or dashes", ErrInvalidPreset)
+	}
+	for _, v := range []int{preset.Width, preset.Height} {
+		if v < minPresetDimension || v > s.maxDimension {
+			return fmt.Errorf("%w: width and height must be between %d and %d pixels", ErrInvalidPreset, minPresetDimension, s.maxDimension)
+		}
+	}
+
+	existing, err := s.repo.FindByName(preset.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != preset.ID {
+		return ErrPresetExists
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+)
+
+// resolveTemplate loads the frame template named by output.TemplateID
+func (s *QRCampaignService) resolveTemplate(output OutputOptions) (OutputOptions, error) {
+	t, err := s.templates.FindByID(output.TemplateID)
+	if err != nil {
+		return output, err
+	}
+	if t == nil {
+		return output, fmt.Errorf("%w: unknown template_id %q", ErrInvalidOutput, output.TemplateID)
+	}
+	output.template = t
+	return output, nil
+}
+
+// composeTemplate fits src into the template's window, draws the frame over
+// it and returns the canvas with the QR layer for the slot. The QR fills the
+// slot, so the position, size and padding options do not apply.
+func (s *QRCampaignService) composeTemplate(campaign *domain.QRCampaign, src image.Image, overlay OverlayOptions, t *domain.FrameTemplate, dpi int) (*image.RGBA, *overlayLayer, error) {
+	frame, err := png.Decode(bytes.NewReader(t.ImageData))
+	if err != nil {
+		return nil, nil, fmt.Errorf("decode frame template %s: %w", t.ID, err)
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, frame.Bounds().Dx(), frame.Bounds().Dy()))
+	window := t.Window.Rect()
+	draw.Draw(canvas, window, smartCrop(src, window.Dx(), window.Dy()), image.Point{}, draw.Src)
+	draw.Draw(canvas, canvas.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+	sizeRatio, padding := 1.0, 0
+	overlay.Position, overlay.X, overlay.Y = OverlayCenter, nil, nil
+	overlay.SizeRatio, overlay.Padding = &sizeRatio, &padding
+	layer, err := s.newOverlayLayer(campaign, canvas.SubImage(t.Slot.Rect()), overlay, dpi)
+	if err != nil {
+		return nil, nil, err
+	}
+	return canvas, layer, nil
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+)
+
+const (
+	mmPerInch = 25.4
+
+	minDPI = 72
+	maxDPI = 2400
+	// Largest physical QR size accepted, in millimetres
+	maxPrintSizeMM = 1000
+)
+
+var lengthUnits = map[string]float64{
+	"mm": 1,
+	"cm": 10,
+	"in": mmPerInch,
+}
+
+// ParseLength parses a physical length such as "30mm", "3cm" or "1.2in" and
+// returns it in millimetres. The unit is required.
+func ParseLength(s string) (float64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for unit, mm := range lengthUnits {
+		number, ok := strings.CutSuffix(s, unit)
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			break
+		}
+		return v * mm, nil
+	}
+	return 0, fmt.Errorf("invalid length %q: use a number with mm, cm or in", s)
+}
+
+func validDPI(dpi int) bool {
+	return dpi == 0 || (dpi >= minDPI && dpi <= maxDPI)
+}
+
+func validPrintSize(mm float64) bool {
+	return mm > 0 && mm <= maxPrintSizeMM
+}
+
+// mmToPixels is the number of pixels covering mm at dpi
+func mmToPixels(mm float64, dpi int) int {
+	return int(math.Round(mm / mmPerInch * float64(dpi)))
+}
+
+func pixelsToMM(px, dpi int) float64 {
+	return float64(px) / float64(dpi) * mmPerInch
+}
+
+// moduleSizeMM returns the side of one module when the campaign's QR,
+// quiet zone included, is printed sizeMM wide.
+func (s *QRCampaignService) moduleSizeMM(campaign *domain.QRCampaign, sizeMM float64) (float64, error) {
+	opts := campaign.RenderOptions
+	matrix, err := qrMatrix(s.ShortURL(campaign.ShortCode), opts.ErrorCorrection)
+	if err != nil {
+		return 0, err
+	}
+	return sizeMM / float64(len(matrix)+2*opts.QuietZone), nil
+}
+
+// checkPrintSize rejects a physical QR size whose modules are smaller than
+// the configured minimum, since scanners cannot resolve them in print. The
+// returned error wraps sentinel.
+func (s *QRCampaignService) checkPrintSize(campaign *domain.QRCampaign, sizeMM float64, sentinel error) error {
+	module, err := s.moduleSizeMM(campaign, sizeMM)
+	if err != nil {
+		return err
+	}
+	if module < s.minModuleMM {
+		return fmt.Errorf("%w: a %.1f mm QR has %.2f mm modules, below the %.2f mm minimum; print it larger",
+			sentinel, sizeMM, module, s.minModuleMM)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+)
+
+const defaultCampaignDuration = 7 * 24 * time.Hour
+
+var (
+	ErrInvalidSchedule = errors.New("invalid schedule")
+	ErrScheduleOverlap = errors.New("schedule overlaps another campaign")
+)
+
+// Accepted layouts for starts_at/ends_at. Values without an offset are
+// interpreted in the campaign's time zone.
+var scheduleLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+type campaignSchedule struct {
+	startsAt *time.Time
+	endsAt   time.Time
+	timezone string
+}
+
+// parseSchedule validates the requested window. Without starts_at the campaign
+// starts immediately; without ends_at it runs for the default duration.
+func parseSchedule(startsAt, endsAt, timezone string, now time.Time) (*campaignSchedule, error) {
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown timezone %q", ErrInvalidSchedule, timezone)
+	}
+
+	schedule := &campaignSchedule{timezone: timezone}
+	start := now
+
+	if startsAt != "" {
+		t, err := parseScheduleTime(startsAt, loc)
+		if err != nil {
+			return nil, fmt.Errorf("%w: starts_at %v", ErrInvalidSchedule, err)
+		}
+		schedule.startsAt = &t
+		start = t
+	}
+
+	schedule.endsAt = start.Add(defaultCampaignDuration)
+	if endsAt != "" {
+		t, err := parseScheduleTime(endsAt, loc)
+		if err != nil {
+			return nil, fmt.Errorf("%w: ends_at %v", ErrInvalidSchedule, err)
+		}
+		schedule.endsAt = t
+	}
+
+	if !schedule.endsAt.After(start) {
+		return nil, fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidSchedule)
+	}
+	if !schedule.endsAt.After(now) {
+		return nil, fmt.Errorf("%w: ends_at must be in the future", ErrInvalidSchedule)
+	}
+
+	return schedule, nil
+}
+
+// parseScheduleTime parses a timestamp in loc and converts it to server local
+// time, which is how timestamps are stored in qr_campaigns.
+func parseScheduleTime(value string, loc *time.Location) (time.Time, error) {
+	for _, layout := range scheduleLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t.In(time.Local), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("must be RFC3339 or YYYY-MM-DDTHH:MM[:SS], got %q", value)
+}
+
+// checkScheduleOverlap rejects a window that overlaps a campaign the
+// scheduler has yet to activate, and a window starting later that overlaps
+// the active campaign; otherwise the scheduler would silently deactivate one
+// of them. A window starting now is checked from now, and may overlap the
+// active campaign, which it replaces explicitly. This also rejects a campaign
+// starting now whose default duration reaches into a pending one; it must
+// then end before the pending campaign starts. Windows are half-open, so one
+// may end exactly when the other starts.
+func (s *QRCampaignService) checkScheduleOverlap(schedule *campaignSchedule, excludeID string, now time.Time) error {
+	start, later := now, false
+	if schedule.startsAt != nil && schedule.startsAt.After(now) {
+		start, later = *schedule.startsAt, true
+	}
+
+	other, err := s.repo.FindOverlappingSchedule(start, schedule.endsAt, later, excludeID)
+	if err != nil {
+		return err
+	}
+	if other != nil {
+		otherStart := other.CreatedAt
+		if other.StartsAt != nil {
+			otherStart = *other.StartsAt
+		}
+		return fmt.Errorf("%w: %q runs from %s to %s", ErrScheduleOverlap, other.Name,
+			otherStart.Format(time.RFC3339), other.ExpiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// ActivateScheduledCampaigns activates scheduled campaigns whose start time has
+// been reached. Each campaign is activated once, so a later manual activation
+// is not overridden. It is run periodically by the scheduler.
+func (s *QRCampaignService) ActivateScheduledCampaigns() error {
+	now := time.Now()
+	due, err := s.repo.FindDueScheduled(now)
+	if err != nil {
+		return err
+	}
+
+	for _, campaign := range due {
+		if campaign.IsExpired(now) {
+			log.Printf("[INFO] scheduled campaign %q (%s) ended before it could be activated, skipping", campaign.Name, campaign.ID)
+		} else {
+			if err := s.activateScheduled(campaign); err != nil {
+				return err
+			}
+			log.Printf("[INFO] scheduled campaign %q (%s) started at %s, activated", campaign.Name, campaign.ID, campaign.StartsAt.Format(time.RFC3339))
+		}
+
+		if err := s.repo.MarkScheduleActivated(campaign.ID, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *QRCampaignService) activateScheduled(campaign *domain.QRCampaign) error {
+	if err := s.repo.SetActive(campaign.ID); err != nil {
+		return err
+	}
+	campaign.IsActive = true
+	s.setCache(campaign)
+	return nil
+}
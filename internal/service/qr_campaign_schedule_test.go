@@ -0,0 +1,83 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+)
+
+func TestCheckScheduleOverlap(t *testing.T) {
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	at := func(s string) time.Time {
+		t.Helper()
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name             string
+		startsAt, endsAt string
+		excludeID        string
+		want             overlapQuery
+	}{
+		// Without starts_at the campaign starts now and replaces the active one
+		{"open-ended start", "", "2026-03-05T00:00:00Z", "", overlapQuery{now, at("2026-03-05T00:00:00Z"), false, ""}},
+		// Without ends_at it runs for the default duration
+		{"open-ended end", "2026-03-10T00:00:00Z", "", "", overlapQuery{at("2026-03-10T00:00:00Z"), at("2026-03-17T00:00:00Z"), true, ""}},
+		{"both open", "", "", "", overlapQuery{now, now.Add(defaultCampaignDuration), false, ""}},
+		// A start that has passed counts as starting now
+		{"start in the past", "2026-02-20T00:00:00Z", "2026-03-05T00:00:00Z", "", overlapQuery{now, at("2026-03-05T00:00:00Z"), false, ""}},
+		{"start exactly now", "2026-03-01T09:00:00Z", "2026-03-05T00:00:00Z", "", overlapQuery{now, at("2026-03-05T00:00:00Z"), false, ""}},
+		{"excludes itself", "2026-03-10T00:00:00Z", "2026-03-12T00:00:00Z", "self", overlapQuery{at("2026-03-10T00:00:00Z"), at("2026-03-12T00:00:00Z"), true, "self"}},
+	}
+	for _, tt := range tests {
+		schedule, err := parseSchedule(tt.startsAt, tt.endsAt, "UTC", now)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		repo := &fakeCampaignRepo{}
+		s := &QRCampaignService{repo: repo}
+		if err := s.checkScheduleOverlap(schedule, tt.excludeID, now); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		got := repo.overlapQuery
+		if got == nil || !got.startsAt.Equal(tt.want.startsAt) || !got.endsAt.Equal(tt.want.endsAt) ||
+			got.includeActive != tt.want.includeActive || got.excludeID != tt.want.excludeID {
+			t.Errorf("%s: query = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckScheduleOverlapError(t *testing.T) {
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	startsAt := now.Add(48 * time.Hour)
+	schedule := &campaignSchedule{endsAt: now.Add(72 * time.Hour)}
+
+	tests := []struct {
+		name      string
+		other     *domain.QRCampaign
+		wantStart time.Time
+	}{
+		{"scheduled", &domain.QRCampaign{Name: "Promo", StartsAt: &startsAt, ExpiresAt: now.Add(96 * time.Hour)}, startsAt},
+		// A campaign without starts_at runs from its creation
+		{"nil starts_at", &domain.QRCampaign{Name: "Promo", CreatedAt: now.Add(-time.Hour), ExpiresAt: now.Add(96 * time.Hour)}, now.Add(-time.Hour)},
+	}
+	for _, tt := range tests {
+		s := &QRCampaignService{repo: &fakeCampaignRepo{overlapping: tt.other}}
+		err := s.checkScheduleOverlap(schedule, "", now)
+		if !errors.Is(err, ErrScheduleOverlap) {
+			t.Errorf("%s: err = %v, want ErrScheduleOverlap", tt.name, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.wantStart.Format(time.RFC3339)) {
+			t.Errorf("%s: %q does not name the start %s", tt.name, err, tt.wantStart.Format(time.RFC3339))
+		}
+	}
+}
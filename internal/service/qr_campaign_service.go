@@ -2,55 +2,126 @@ package service
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
 	"errors"
+	"fmt"
 	"image"
 	"image/draw"
 	"image/jpeg"
-	"image/png"
 	"io"
+	"log"
 	"sync"
 	"time"
 
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/config"
 	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
-	qrcode "github.com/skip2/go-qrcode"
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/workerpool"
+	"github.com/IMPHNEN/imphnen-backend-qr/pkg/exif"
 )
 
 var (
-	ErrCampaignNotFound  = errors.New("campaign not found")
-	ErrNoActiveCampaign  = errors.New("no active campaign")
-	ErrInvalidImage      = errors.New("invalid image format, only PNG and JPEG are supported")
+	ErrCampaignNotFound = errors.New("campaign not found")
+	ErrNoActiveCampaign = errors.New("no active campaign")
+	ErrCampaignExpired  = errors.New("campaign expired")
+	ErrRevisionNotFound = errors.New("revision not found")
+	ErrServerBusy       = errors.New("image processing is at capacity")
+	ErrInvalidImage     = errors.New("invalid image format, only PNG, JPEG, WebP, GIF, BMP and TIFF are supported")
+)
+
+const (
+	shortCodeLength   = 8
+	shortCodeAlphabet = "abcdefghjkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
 )
 
 type QRCampaignService struct {
-	repo              domain.QRCampaignRepository
-	cacheMu           sync.RWMutex
-	cachedQR          []byte
-	cachedCampaignID  string
+	repo        domain.QRCampaignRepository
+	presets     domain.ImagePresetRepository
+	templates   domain.FrameTemplateRepository
+	baseURL     string
+	limits      ImageLimits
+	minModuleMM float64
+	verifyMode  string
+	pool        *workerpool.Pool
+	cacheMu     sync.RWMutex
+	cached      *domain.QRCampaign // active campaign, read-only once cached
 }
 
+// CreateCampaignInput describes a new campaign. StartsAt and EndsAt are
+// optional; values without an offset are read in Timezone (default UTC).
 type CreateCampaignInput struct {
-	Name string `json:"name"`
-	URL  string `json:"url"`
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	StartsAt string `json:"starts_at"`
+	EndsAt   string `json:"ends_at"`
+	Timezone string `json:"timezone"`
+
+	RenderOptions *RenderOptionsInput `json:"render_options"`
+	Overlay       *OverlayLayoutInput `json:"overlay"`
+}
+
+func NewQRCampaignService(repo domain.QRCampaignRepository, presets domain.ImagePresetRepository, templates domain.FrameTemplateRepository, cfg *config.Config) *QRCampaignService {
+	return &QRCampaignService{
+		repo:        repo,
+		presets:     presets,
+		templates:   templates,
+		baseURL:     cfg.PublicBaseURL,
+		limits:      newImageLimits(cfg),
+		minModuleMM: cfg.MinModuleSizeMM,
+		verifyMode:  cfg.QRVerifyMode,
+		pool:        workerpool.New(cfg.ProcessConcurrency, cfg.ProcessQueueDepth, cfg.ProcessQueueTimeout),
+	}
+}
+
+// ImageLimits returns the limits applied to process-image uploads
+func (s *QRCampaignService) ImageLimits() ImageLimits {
+	return s.limits
 }
 
-func NewQRCampaignService(repo domain.QRCampaignRepository) *QRCampaignService {
-	return &QRCampaignService{repo: repo}
+// ShortURL returns the public redirect URL that a campaign QR encodes.
+func (s *QRCampaignService) ShortURL(code string) string {
+	return s.baseURL + "/r/" + code
 }
 
 func (s *QRCampaignService) CreateCampaign(input CreateCampaignInput, createdBy string) (*domain.QRCampaign, error) {
-	// Generate QR PNG bytes (256x256, medium recovery)
-	qrBytes, err := qrcode.Encode(input.URL, qrcode.Medium, 256)
+	now := time.Now()
+	schedule, err := parseSchedule(input.StartsAt, input.EndsAt, input.Timezone, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkScheduleOverlap(schedule, "", now); err != nil {
+		return nil, err
+	}
+	renderOptions, err := normalizeRenderOptions(input.RenderOptions, DefaultRenderOptions())
+	if err != nil {
+		return nil, err
+	}
+	overlay, err := normalizeOverlayLayout(input.Overlay, DefaultOverlayLayout())
+	if err != nil {
+		return nil, err
+	}
+
+	shortCode, err := s.newShortCode()
 	if err != nil {
 		return nil, err
 	}
 
 	campaign := &domain.QRCampaign{
-		Name:       input.Name,
-		URL:        input.URL,
-		QRCodeData: qrBytes,
-		IsActive:   false,
-		CreatedBy:  createdBy,
-		ExpiresAt:  time.Now().Add(7 * 24 * time.Hour),
+		Name:          input.Name,
+		URL:           input.URL,
+		ShortCode:     shortCode,
+		RenderOptions: renderOptions,
+		Overlay:       overlay,
+		IsActive:      false,
+		CreatedBy:     createdBy,
+		StartsAt:      schedule.startsAt,
+		ExpiresAt:     schedule.endsAt,
+		Timezone:      schedule.timezone,
+	}
+
+	campaign.QRCodeData, err = s.renderQR(campaign)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create campaign first (inactive to avoid unique index conflict)
@@ -58,17 +129,24 @@ func (s *QRCampaignService) CreateCampaign(input CreateCampaignInput, createdBy
 		return nil, err
 	}
 
+	// Campaigns scheduled for later are activated by the scheduler
+	if campaign.StartsAt != nil && campaign.StartsAt.After(now) {
+		return campaign, nil
+	}
+
 	// Then activate it (deactivates all others in a transaction)
 	if err := s.repo.SetActive(campaign.ID); err != nil {
 		return nil, err
 	}
 	campaign.IsActive = true
 
-	// Update cache
-	s.cacheMu.Lock()
-	s.cachedQR = qrBytes
-	s.cachedCampaignID = campaign.ID
-	s.cacheMu.Unlock()
+	s.setCache(campaign)
+
+	if campaign.StartsAt != nil {
+		if err := s.repo.MarkScheduleActivated(campaign.ID, now); err != nil {
+			return nil, err
+		}
+	}
 
 	return campaign, nil
 }
@@ -76,22 +154,23 @@ func (s *QRCampaignService) CreateCampaign(input CreateCampaignInput, createdBy
 func (s *QRCampaignService) GetActiveCampaign() (*domain.QRCampaign, error) {
 	// Check cache first
 	s.cacheMu.RLock()
-	cachedID := s.cachedCampaignID
+	cached := s.cached
 	s.cacheMu.RUnlock()
 
-	if cachedID != "" {
-		campaign, err := s.repo.FindByID(cachedID)
+	if cached != nil {
+		campaign, err := s.repo.FindByID(cached.ID)
 		if err != nil {
 			return nil, err
 		}
 		if campaign != nil && campaign.IsActive {
+			if campaign.IsExpired(time.Now()) {
+				s.clearCache()
+				return nil, ErrCampaignExpired
+			}
 			return campaign, nil
 		}
 		// Cache is stale, clear it
-		s.cacheMu.Lock()
-		s.cachedQR = nil
-		s.cachedCampaignID = ""
-		s.cacheMu.Unlock()
+		s.clearCache()
 	}
 
 	// Fallback to DB
@@ -102,44 +181,308 @@ func (s *QRCampaignService) GetActiveCampaign() (*domain.QRCampaign, error) {
 	if campaign == nil {
 		return nil, ErrNoActiveCampaign
 	}
+	// The scheduler may not have deactivated it yet
+	if campaign.IsExpired(time.Now()) {
+		return nil, ErrCampaignExpired
+	}
 
-	// Update cache
-	s.cacheMu.Lock()
-	s.cachedQR = campaign.QRCodeData
-	s.cachedCampaignID = campaign.ID
-	s.cacheMu.Unlock()
+	s.setCache(campaign)
+
+	return campaign, nil
+}
+
+// UpdateCampaignInput holds the editable campaign fields. Empty fields are
+// left unchanged; ExpiresAt without an offset is read in the campaign's time zone.
+type UpdateCampaignInput struct {
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	ExpiresAt string `json:"expires_at"`
+
+	RenderOptions *RenderOptionsInput `json:"render_options"`
+	Overlay       *OverlayLayoutInput `json:"overlay"`
+}
+
+func (s *QRCampaignService) UpdateCampaign(id string, input UpdateCampaignInput, changedBy string) (*domain.QRCampaign, error) {
+	return s.editCampaign(id, changedBy, domain.RevisionActionUpdate, func(campaign *domain.QRCampaign) (bool, bool, error) {
+		if input.Name != "" {
+			campaign.Name = input.Name
+		}
+		urlChanged := input.URL != "" && input.URL != campaign.URL
+		if urlChanged {
+			campaign.URL = input.URL
+		}
+		expiryChanged := false
+		if input.ExpiresAt != "" {
+			loc, err := time.LoadLocation(campaign.Timezone)
+			if err != nil {
+				loc = time.UTC
+			}
+			expiresAt, err := parseScheduleTime(input.ExpiresAt, loc)
+			if err != nil {
+				return false, false, fmt.Errorf("%w: expires_at %v", ErrInvalidSchedule, err)
+			}
+			campaign.ExpiresAt = expiresAt
+			expiryChanged = true
+		}
+		optionsChanged := false
+		if input.RenderOptions != nil {
+			renderOptions, err := normalizeRenderOptions(input.RenderOptions, campaign.RenderOptions)
+			if err != nil {
+				return false, false, err
+			}
+			optionsChanged = renderOptions != campaign.RenderOptions
+			campaign.RenderOptions = renderOptions
+		}
+		if input.Overlay != nil {
+			overlay, err := normalizeOverlayLayout(input.Overlay, campaign.Overlay)
+			if err != nil {
+				return false, false, err
+			}
+			campaign.Overlay = overlay
+		}
+		return urlChanged || optionsChanged, expiryChanged, nil
+	})
+}
+
+func (s *QRCampaignService) GetRevisions(id string) ([]*domain.QRCampaignRevision, error) {
+	campaign, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if campaign == nil {
+		return nil, ErrCampaignNotFound
+	}
+	return s.repo.FindRevisions(id)
+}
+
+// RollbackCampaign restores the name, URL and expiry from an earlier revision.
+// The rollback itself is recorded as a new revision.
+func (s *QRCampaignService) RollbackCampaign(id string, revision int, changedBy string) (*domain.QRCampaign, error) {
+	return s.editCampaign(id, changedBy, domain.RevisionActionRollback, func(campaign *domain.QRCampaign) (bool, bool, error) {
+		rev, err := s.repo.FindRevision(id, revision)
+		if err != nil {
+			return false, false, err
+		}
+		if rev == nil {
+			return false, false, ErrRevisionNotFound
+		}
+
+		urlChanged := rev.URL != campaign.URL
+		expiryChanged := !rev.ExpiresAt.Equal(campaign.ExpiresAt)
+		campaign.Name = rev.Name
+		campaign.URL = rev.URL
+		campaign.ExpiresAt = rev.ExpiresAt
+		return urlChanged, expiryChanged, nil
+	})
+}
+
+// campaignEdit changes a campaign loaded for update and reports whether its QR
+// has to be rendered again and whether its expiry changed.
+type campaignEdit func(campaign *domain.QRCampaign) (rerender, expiryChanged bool, err error)
+
+// editCampaign applies edit to the campaign while its row is locked, so
+// concurrent edits of different fields (say a logo upload and new overlay
+// defaults) each start from the other's result instead of overwriting it. The
+// edited campaign is then validated, re-rendered if needed and saved with a
+// revision, and the cache is refreshed if it is the active one.
+func (s *QRCampaignService) editCampaign(id, changedBy, action string, edit campaignEdit) (*domain.QRCampaign, error) {
+	campaign, err := s.repo.Update(id, changedBy, action, func(campaign *domain.QRCampaign) error {
+		rerender, expiryChanged, err := edit(campaign)
+		if err != nil {
+			return err
+		}
+		return s.prepareSave(campaign, rerender, expiryChanged)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if campaign == nil {
+		return nil, ErrCampaignNotFound
+	}
+
+	if campaign.IsActive {
+		s.setCache(campaign)
+	}
 
 	return campaign, nil
 }
 
+// prepareSave validates an edited campaign and regenerates its QR when the URL
+// or render options changed.
+func (s *QRCampaignService) prepareSave(campaign *domain.QRCampaign, rerender, expiryChanged bool) error {
+	if expiryChanged {
+		now := time.Now()
+		if !campaign.ExpiresAt.After(now) {
+			return fmt.Errorf("%w: expires_at must be in the future", ErrInvalidSchedule)
+		}
+		if campaign.StartsAt != nil && !campaign.ExpiresAt.After(*campaign.StartsAt) {
+			return fmt.Errorf("%w: expires_at must be after starts_at", ErrInvalidSchedule)
+		}
+		if campaign.StartsAt != nil || campaign.IsActive {
+			schedule := &campaignSchedule{startsAt: campaign.StartsAt, endsAt: campaign.ExpiresAt}
+			if err := s.checkScheduleOverlap(schedule, campaign.ID, now); err != nil {
+				return err
+			}
+		}
+	}
+
+	if rerender {
+		// The QR encodes the short link, but regenerate it so the stored
+		// image always matches the campaign's current state
+		qrBytes, err := s.renderQR(campaign)
+		if err != nil {
+			return err
+		}
+		campaign.QRCodeData = qrBytes
+	}
+	return nil
+}
+
+// SetCampaignLogo stores a PNG or JPEG logo for the campaign and re-renders its
+// QR with the logo composited in the center.
+func (s *QRCampaignService) SetCampaignLogo(id string, logo io.Reader, changedBy string) (*domain.QRCampaign, error) {
+	data, err := io.ReadAll(io.LimitReader(logo, maxLogoBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decodeLogo(data); err != nil {
+		return nil, err
+	}
+
+	return s.editCampaign(id, changedBy, domain.RevisionActionUpdate, func(campaign *domain.QRCampaign) (bool, bool, error) {
+		campaign.LogoData = data
+		campaign.HasLogo = true
+		return true, false, nil
+	})
+}
+
+// RemoveCampaignLogo drops the campaign's logo and re-renders a plain QR. The
+// error correction level raised for the logo is kept.
+func (s *QRCampaignService) RemoveCampaignLogo(id, changedBy string) (*domain.QRCampaign, error) {
+	return s.editCampaign(id, changedBy, domain.RevisionActionUpdate, func(campaign *domain.QRCampaign) (bool, bool, error) {
+		campaign.LogoData = nil
+		campaign.HasLogo = false
+		return true, false, nil
+	})
+}
+
+// ResolveShortCode returns the campaign a short code points to, regardless of
+// whether it is currently active, so printed QR codes keep working.
+func (s *QRCampaignService) ResolveShortCode(code string) (*domain.QRCampaign, error) {
+	campaign, err := s.repo.FindByShortCode(code)
+	if err != nil {
+		return nil, err
+	}
+	if campaign == nil {
+		return nil, ErrCampaignNotFound
+	}
+	return campaign, nil
+}
+
 func (s *QRCampaignService) GetAllCampaigns() ([]*domain.QRCampaign, error) {
 	return s.repo.FindAll()
 }
 
 func (s *QRCampaignService) SetActiveCampaign(id string) error {
+	campaign, err := s.repo.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if campaign == nil {
+		return ErrCampaignNotFound
+	}
+	if campaign.IsExpired(time.Now()) {
+		return ErrCampaignExpired
+	}
+
 	if err := s.repo.SetActive(id); err != nil {
 		return ErrCampaignNotFound
 	}
+	campaign.IsActive = true
 
-	// Refresh cache
-	campaign, err := s.repo.FindByID(id)
+	s.setCache(campaign)
+
+	return nil
+}
+
+// ExpireCampaigns deactivates active campaigns whose expiry has passed and
+// drops them from the cache. It is run periodically by the scheduler.
+func (s *QRCampaignService) ExpireCampaigns() error {
+	expired, err := s.repo.DeactivateExpired(time.Now())
 	if err != nil {
 		return err
 	}
 
-	s.cacheMu.Lock()
-	if campaign != nil {
-		s.cachedQR = campaign.QRCodeData
-		s.cachedCampaignID = campaign.ID
-	} else {
-		s.cachedQR = nil
-		s.cachedCampaignID = ""
+	for _, campaign := range expired {
+		log.Printf("[INFO] campaign %q (%s) expired at %s, deactivated", campaign.Name, campaign.ID, campaign.ExpiresAt.Format(time.RFC3339))
+		s.invalidateCache(campaign.ID)
 	}
-	s.cacheMu.Unlock()
+	return nil
+}
 
+// NormalizeCampaignURLs normalizes the URLs of campaigns stored before the
+// normalized URL was kept, so the decode endpoint can match them. It is run
+// once on startup.
+func (s *QRCampaignService) NormalizeCampaignURLs() error {
+	updated, err := s.repo.NormalizeURLs()
+	if err != nil {
+		return err
+	}
+	if updated > 0 {
+		log.Printf("[INFO] normalized the URLs of %d campaigns", updated)
+	}
 	return nil
 }
 
+// SyncStoredQRCodes renders again every stored QR image that does not decode
+// to its campaign's short link. Campaigns created before QRs encoded the short
+// link still hold their destination URL, and a changed PUBLIC_BASE_URL leaves
+// every stored QR behind; scans of those would bypass the redirect and its
+// analytics. It is run once on startup.
+func (s *QRCampaignService) SyncStoredQRCodes() error {
+	campaigns, err := s.repo.FindAll()
+	if err != nil {
+		return err
+	}
+
+	updated := 0
+	for _, campaign := range campaigns {
+		if s.storedQRCurrent(campaign) {
+			continue
+		}
+		old := campaign.QRCodeData
+		data, err := s.renderQR(campaign)
+		if err != nil {
+			log.Printf("[ERROR] SyncStoredQRCodes: campaign %s: %v", campaign.ID, err)
+			continue
+		}
+		// An edit in the meantime has rendered it already
+		ok, err := s.repo.ReplaceQRCodeData(campaign.ID, old, data)
+		if err != nil {
+			return err
+		}
+		if ok {
+			updated++
+			s.invalidateCache(campaign.ID)
+		}
+	}
+	if updated > 0 {
+		log.Printf("[INFO] re-rendered the stored QR of %d campaigns", updated)
+	}
+	return nil
+}
+
+// storedQRCurrent reports whether the campaign's stored QR image decodes to
+// its short link
+func (s *QRCampaignService) storedQRCurrent(campaign *domain.QRCampaign) bool {
+	img, _, err := image.Decode(bytes.NewReader(campaign.QRCodeData))
+	if err != nil {
+		return false
+	}
+	text, err := decodeQR(img)
+	return err == nil && text == s.ShortURL(campaign.ShortCode)
+}
+
 func (s *QRCampaignService) DeleteCampaign(id string) error {
 	campaign, err := s.repo.FindByID(id)
 	if err != nil {
@@ -154,98 +497,248 @@ func (s *QRCampaignService) DeleteCampaign(id string) error {
 	}
 
 	// Invalidate cache if deleted campaign was the cached one
-	s.cacheMu.Lock()
-	if s.cachedCampaignID == id {
-		s.cachedQR = nil
-		s.cachedCampaignID = ""
-	}
-	s.cacheMu.Unlock()
+	s.invalidateCache(id)
 
 	return nil
 }
 
-func (s *QRCampaignService) ProcessImage(uploadedImage io.Reader) ([]byte, error) {
+// ProcessImage overlays the active campaign QR onto the uploaded image.
+// Unset overlay options fall back to the campaign's layout, then to
+// DefaultOverlayOptions. The result keeps the input format unless output
+// selects another one.
+func (s *QRCampaignService) ProcessImage(ctx context.Context, uploadedImage io.Reader, overlay OverlayOptions, output OutputOptions) (*ProcessedImage, error) {
+	campaign, overlay, output, err := s.prepareProcessing(overlay, output)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.limits.readImage(uploadedImage)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.runProcessing(ctx, campaign, data, overlay, output)
+}
+
+// prepareProcessing resolves the active campaign and merges the request's
+// options with its layout and the defaults.
+func (s *QRCampaignService) prepareProcessing(overlay OverlayOptions, output OutputOptions) (*domain.QRCampaign, OverlayOptions, OutputOptions, error) {
+	output, err := output.normalize()
+	if err != nil {
+		return nil, overlay, output, err
+	}
+	if output.Preset != "" {
+		preset, err := s.presets.FindByName(output.Preset)
+		if err != nil {
+			return nil, overlay, output, err
+		}
+		if preset == nil {
+			return nil, overlay, output, fmt.Errorf("%w: unknown preset %q", ErrInvalidOutput, output.Preset)
+		}
+		output.Width, output.Height = preset.Width, preset.Height
+	}
+	if overlay.PrintSize != nil && output.DPI == 0 {
+		return nil, overlay, output, fmt.Errorf("%w: qr_size requires dpi", ErrInvalidOverlay)
+	}
+	if output.TemplateID != "" {
+		if output.Width > 0 {
+			return nil, overlay, output, fmt.Errorf("%w: preset and template_id cannot be combined", ErrInvalidOutput)
+		}
+		if overlay.PrintSize != nil {
+			return nil, overlay, output, fmt.Errorf("%w: qr_size cannot be combined with template_id, the template's slot sets the size", ErrInvalidOutput)
+		}
+		if output, err = s.resolveTemplate(output); err != nil {
+			return nil, overlay, output, err
+		}
+	}
+
 	// Get active campaign QR from cache
 	s.cacheMu.RLock()
-	qrData := s.cachedQR
+	campaign := s.cached
 	s.cacheMu.RUnlock()
 
-	if qrData == nil {
+	if campaign != nil && campaign.IsExpired(time.Now()) {
+		s.clearCache()
+		return nil, overlay, output, ErrCampaignExpired
+	}
+
+	if campaign == nil {
 		// Try loading from DB
-		campaign, err := s.GetActiveCampaign()
+		if campaign, err = s.GetActiveCampaign(); err != nil {
+			return nil, overlay, output, err
+		}
+	}
+
+	defaults, err := overlayFromLayout(campaign.Overlay)
+	if err != nil {
+		return nil, overlay, output, err
+	}
+	overlay = overlay.merge(defaults.merge(DefaultOverlayOptions()))
+	if err := overlay.validate(); err != nil {
+		return nil, overlay, output, err
+	}
+	return campaign, overlay, output, nil
+}
+
+// runProcessing composites data in the bounded pool, since decoding and
+// encoding are CPU-bound.
+func (s *QRCampaignService) runProcessing(ctx context.Context, campaign *domain.QRCampaign, data []byte, overlay OverlayOptions, output OutputOptions) (*ProcessedImage, error) {
+	var result *ProcessedImage
+	err := s.pool.Do(ctx, func() error {
+		var err error
+		result, err = s.compositeImage(campaign, data, overlay, output)
+		return err
+	})
+	if errors.Is(err, workerpool.ErrQueueFull) || errors.Is(err, workerpool.ErrQueueTimeout) {
+		return nil, fmt.Errorf("%w: %v", ErrServerBusy, err)
+	}
+	return result, err
+}
+
+// ProcessingStats reports the image processing pool's load
+func (s *QRCampaignService) ProcessingStats() workerpool.Stats {
+	return s.pool.Stats()
+}
+
+// compositeImage decodes an upload, places the campaign QR on it and encodes
+// the result. overlay and output must already be merged and validated.
+func (s *QRCampaignService) compositeImage(campaign *domain.QRCampaign, data []byte, overlay OverlayOptions, output OutputOptions) (*ProcessedImage, error) {
+	// Animated GIFs keep every frame unless another output format, a preset or
+	// a template is requested
+	if bytes.HasPrefix(data, gifMagic) && (output.Format == "" || output.Format == ImageFormatGIF) && output.Width == 0 && output.template == nil {
+		anim, err := s.limits.decodeAnimation(data)
 		if err != nil {
 			return nil, err
 		}
-		qrData = campaign.QRCodeData
+		if len(anim.Image) > 1 {
+			return s.compositeAnimation(campaign, anim, overlay, output)
+		}
 	}
 
-	// Decode uploaded image (PNG or JPEG)
-	srcImg, _, err := image.Decode(uploadedImage)
+	// Decode uploaded image (any registered format)
+	srcImg, inputFormat, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
 		return nil, ErrInvalidImage
 	}
 
-	// Decode QR PNG bytes to image
-	qrImg, err := png.Decode(bytes.NewReader(qrData))
-	if err != nil {
-		return nil, err
+	// Phones store portrait photos sideways plus an EXIF Orientation tag, so
+	// rotate before placing the QR
+	var metadata []byte
+	if inputFormat == ImageFormatJPEG {
+		if metadata = exif.FromJPEG(data); metadata != nil {
+			srcImg = exif.Orient(srcImg, exif.Orientation(metadata))
+			metadata = exif.WithoutOrientation(metadata)
+		}
 	}
 
-	srcBounds := srcImg.Bounds()
-	srcW := srcBounds.Dx()
-	srcH := srcBounds.Dy()
+	var canvas *image.RGBA
+	var layer *overlayLayer
+	if output.template != nil {
+		if canvas, layer, err = s.composeTemplate(campaign, srcImg, overlay, output.template, output.DPI); err != nil {
+			return nil, err
+		}
+	} else {
+		if output.Width > 0 {
+			srcImg = smartCrop(srcImg, output.Width, output.Height)
+		}
+
+		srcBounds := srcImg.Bounds()
+		if layer, err = s.newOverlayLayer(campaign, srcImg, overlay, output.DPI); err != nil {
+			return nil, err
+		}
 
-	// Calculate QR size: ~1/5 of smallest dimension, minimum 100px
-	minDim := srcW
-	if srcH < minDim {
-		minDim = srcH
-	}
-	qrSize := minDim / 5
-	if qrSize < 100 {
-		qrSize = 100
+		// Create output canvas
+		canvas = image.NewRGBA(srcBounds)
+		draw.Draw(canvas, srcBounds, srcImg, srcBounds.Min, draw.Src)
 	}
+	layer.drawOn(canvas)
 
-	// Resize QR if needed (simple nearest-neighbor scaling)
-	qrResized := resizeImage(qrImg, qrSize, qrSize)
+	result, err := encodeImage(canvas, output.outputFormat(inputFormat, canvas), output.Quality)
+	if err != nil {
+		return nil, err
+	}
+	if output.KeepMetadata && metadata != nil {
+		result.attachExif(metadata)
+	}
+	if output.DPI > 0 {
+		result.setDensity(output.DPI)
+	}
+	if err := s.verifyOutput(campaign, result, canvas, layer.qrRect, output.Quality, output.verifyMode(s.verifyMode)); err != nil {
+		return nil, err
+	}
+	result.Position = layer.position
+	return result, nil
+}
 
-	// Create output canvas
-	padding := 10
-	canvas := image.NewRGBA(srcBounds)
-	draw.Draw(canvas, srcBounds, srcImg, srcBounds.Min, draw.Src)
+// renderQR generates the campaign's QR PNG using its render options. It
+// encodes the short link, so the destination can change without reprinting.
+// If the campaign has a logo, its error correction level is raised as needed.
+// The result is read back; depending on the verify mode a failure is an
+// error or recorded in campaign.ScanWarning.
+func (s *QRCampaignService) renderQR(campaign *domain.QRCampaign) ([]byte, error) {
+	var logo image.Image
+	if len(campaign.LogoData) > 0 {
+		var err error
+		if logo, err = decodeLogo(campaign.LogoData); err != nil {
+			return nil, err
+		}
+	}
 
-	// Draw QR at bottom-right with padding
-	qrRect := image.Rect(
-		srcW-qrSize-padding,
-		srcH-qrSize-padding,
-		srcW-padding,
-		srcH-padding,
-	)
-	draw.Draw(canvas, qrRect, qrResized, qrResized.Bounds().Min, draw.Over)
+	img, opts, err := drawQR(s.ShortURL(campaign.ShortCode), campaign.RenderOptions, logo, campaign.RenderOptions.Size)
+	if err != nil {
+		return nil, err
+	}
+	campaign.RenderOptions = opts
 
-	// Encode to PNG
-	var buf bytes.Buffer
-	if err := png.Encode(&buf, canvas); err != nil {
+	if campaign.ScanWarning, err = s.verifyRenderedQR(campaign, img); err != nil {
 		return nil, err
 	}
+	return encodePNG(img)
+}
+
+func (s *QRCampaignService) setCache(campaign *domain.QRCampaign) {
+	cached := *campaign
+	s.cacheMu.Lock()
+	s.cached = &cached
+	s.cacheMu.Unlock()
+}
+
+func (s *QRCampaignService) clearCache() {
+	s.cacheMu.Lock()
+	s.cached = nil
+	s.cacheMu.Unlock()
+}
 
-	return buf.Bytes(), nil
+// invalidateCache clears the cache only if it currently holds the given campaign
+func (s *QRCampaignService) invalidateCache(id string) {
+	s.cacheMu.Lock()
+	if s.cached != nil && s.cached.ID == id {
+		s.cached = nil
+	}
+	s.cacheMu.Unlock()
 }
 
-// resizeImage performs a simple nearest-neighbor resize
-func resizeImage(src image.Image, width, height int) image.Image {
-	srcBounds := src.Bounds()
-	srcW := srcBounds.Dx()
-	srcH := srcBounds.Dy()
+// newShortCode generates a random short code that is not yet taken
+func (s *QRCampaignService) newShortCode() (string, error) {
+	for attempt := 0; attempt < 5; attempt++ {
+		b := make([]byte, shortCodeLength)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		for i := range b {
+			b[i] = shortCodeAlphabet[int(b[i])%len(shortCodeAlphabet)]
+		}
+		code := string(b)
 
-	dst := image.NewRGBA(image.Rect(0, 0, width, height))
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			srcX := srcBounds.Min.X + x*srcW/width
-			srcY := srcBounds.Min.Y + y*srcH/height
-			dst.Set(x, y, src.At(srcX, srcY))
+		existing, err := s.repo.FindByShortCode(code)
+		if err != nil {
+			return "", err
+		}
+		if existing == nil {
+			return code, nil
 		}
 	}
-	return dst
+	return "", errors.New("failed to generate unique short code")
 }
 
 // Register JPEG decoder for image.Decode
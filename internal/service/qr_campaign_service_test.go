@@ -0,0 +1,204 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/config"
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/workerpool"
+)
+
+// fakeCampaignRepo keeps campaigns in memory. Methods a test does not need
+// are left to the embedded nil interface and panic when called.
+type fakeCampaignRepo struct {
+	domain.QRCampaignRepository
+	campaigns map[string]*domain.QRCampaign
+	// overlapping is returned by FindOverlappingSchedule, which records its
+	// arguments in overlapQuery
+	overlapping  *domain.QRCampaign
+	overlapQuery *overlapQuery
+	// updated lists the IDs saved by Update
+	updated []string
+}
+
+type overlapQuery struct {
+	startsAt, endsAt time.Time
+	includeActive    bool
+	excludeID        string
+}
+
+func (r *fakeCampaignRepo) FindByID(id string) (*domain.QRCampaign, error) {
+	return r.campaigns[id], nil
+}
+
+// Update edits a copy of the stored campaign and stores it back if edit
+// succeeds, like the transaction of the real repository
+func (r *fakeCampaignRepo) Update(id, changedBy, action string, edit func(*domain.QRCampaign) error) (*domain.QRCampaign, error) {
+	stored := r.campaigns[id]
+	if stored == nil {
+		return nil, nil
+	}
+	campaign := *stored
+	if err := edit(&campaign); err != nil {
+		return nil, err
+	}
+	r.campaigns[id] = &campaign
+	r.updated = append(r.updated, id)
+	return &campaign, nil
+}
+
+func (r *fakeCampaignRepo) FindAll() ([]*domain.QRCampaign, error) {
+	var campaigns []*domain.QRCampaign
+	for _, campaign := range r.campaigns {
+		campaigns = append(campaigns, campaign)
+	}
+	return campaigns, nil
+}
+
+func (r *fakeCampaignRepo) ReplaceQRCodeData(id string, old, data []byte) (bool, error) {
+	campaign := r.campaigns[id]
+	if campaign == nil || !bytes.Equal(campaign.QRCodeData, old) {
+		return false, nil
+	}
+	campaign.QRCodeData = data
+	r.updated = append(r.updated, id)
+	return true, nil
+}
+
+func (r *fakeCampaignRepo) FindOverlappingSchedule(startsAt, endsAt time.Time, includeActive bool, excludeID string) (*domain.QRCampaign, error) {
+	r.overlapQuery = &overlapQuery{startsAt, endsAt, includeActive, excludeID}
+	return r.overlapping, nil
+}
+
+func newTestService(repo domain.QRCampaignRepository) *QRCampaignService {
+	return NewQRCampaignService(repo, nil, nil, &config.Config{
+		PublicBaseURL:          "https://qr.example",
+		MaxUploadBytes:         1 << 20,
+		MaxImageDimension:      4000,
+		MaxImageMegapixels:     10,
+		MaxBatchFiles:          10,
+		MaxBatchBytes:          4 << 20,
+		MaxAnimationMegapixels: 50,
+		MinModuleSizeMM:        0.3,
+		QRVerifyMode:           QRVerifyStrict,
+		ProcessConcurrency:     1,
+		ProcessQueueDepth:      1,
+		ProcessQueueTimeout:    time.Second,
+	})
+}
+
+// testCampaign is an active campaign with the default render options and
+// overlay layout, expiring in a day. Its stored QR matches newTestService.
+func testCampaign(id string) *domain.QRCampaign {
+	campaign := &domain.QRCampaign{
+		ID:            id,
+		Name:          "Test",
+		URL:           "https://example.com",
+		ShortCode:     "abcd2345",
+		RenderOptions: DefaultRenderOptions(),
+		Overlay:       DefaultOverlayLayout(),
+		IsActive:      true,
+		ExpiresAt:     time.Now().Add(24 * time.Hour),
+		Timezone:      "UTC",
+	}
+	img, _, err := drawQR("https://qr.example/r/"+campaign.ShortCode, campaign.RenderOptions, nil, campaign.RenderOptions.Size)
+	if err != nil {
+		panic(err)
+	}
+	if campaign.QRCodeData, err = encodePNG(img); err != nil {
+		panic(err)
+	}
+	return campaign
+}
+
+func TestRunProcessingServerBusy(t *testing.T) {
+	for _, depth := range []int{0, 1} {
+		s := newTestService(&fakeCampaignRepo{})
+		// No queue rejects at once; a queue of one times out
+		s.pool = workerpool.New(1, depth, 10*time.Millisecond)
+		release, started := make(chan struct{}), make(chan struct{})
+		go s.pool.Do(context.Background(), func() error {
+			close(started)
+			<-release
+			return nil
+		})
+		<-started
+
+		_, err := s.runProcessing(context.Background(), testCampaign("c"), nil, DefaultOverlayOptions(), OutputOptions{})
+		if !errors.Is(err, ErrServerBusy) {
+			t.Errorf("queue depth %d: err = %v, want ErrServerBusy", depth, err)
+		}
+		close(release)
+	}
+}
+
+func TestUpdateCampaignEditsStoredState(t *testing.T) {
+	stored := testCampaign("c")
+	repo := &fakeCampaignRepo{campaigns: map[string]*domain.QRCampaign{"c": stored}}
+	s := newTestService(repo)
+
+	// Written by another request after this one started
+	stored.LogoData = []byte("logo")
+	caption := "Scan me"
+	got, err := s.UpdateCampaign("c", UpdateCampaignInput{Overlay: &OverlayLayoutInput{Caption: &caption}}, "u")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Overlay.Caption != caption || string(got.LogoData) != "logo" {
+		t.Errorf("caption %q, logo %q: want the new caption and the stored logo", got.Overlay.Caption, got.LogoData)
+	}
+	if s.cached == nil || s.cached.Overlay.Caption != caption {
+		t.Error("active campaign not cached after the update")
+	}
+
+	_, err = s.UpdateCampaign("c", UpdateCampaignInput{Name: "Renamed", ExpiresAt: "2000-01-01T00:00:00Z"}, "u")
+	if !errors.Is(err, ErrInvalidSchedule) {
+		t.Errorf("past expiry: err = %v, want ErrInvalidSchedule", err)
+	}
+	if repo.campaigns["c"].Name != "Test" || len(repo.updated) != 1 {
+		t.Errorf("rejected update was saved: name %q, %d saves", repo.campaigns["c"].Name, len(repo.updated))
+	}
+
+	if _, err := s.UpdateCampaign("missing", UpdateCampaignInput{Name: "x"}, "u"); !errors.Is(err, ErrCampaignNotFound) {
+		t.Errorf("missing campaign: err = %v, want ErrCampaignNotFound", err)
+	}
+}
+
+func TestSyncStoredQRCodes(t *testing.T) {
+	current := testCampaign("current")
+	// Created before QRs encoded the short link
+	legacy := testCampaign("legacy")
+	legacy.ShortCode = "legacy23"
+	legacy.IsActive = false
+	img, _, err := drawQR(legacy.URL, legacy.RenderOptions, nil, legacy.RenderOptions.Size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if legacy.QRCodeData, err = encodePNG(img); err != nil {
+		t.Fatal(err)
+	}
+	broken := testCampaign("broken")
+	broken.QRCodeData = []byte("not a png")
+
+	repo := &fakeCampaignRepo{campaigns: map[string]*domain.QRCampaign{"current": current, "legacy": legacy, "broken": broken}}
+	s := newTestService(repo)
+	if s.storedQRCurrent(legacy) || !s.storedQRCurrent(current) {
+		t.Fatal("storedQRCurrent does not tell the legacy QR apart")
+	}
+	if err := s.SyncStoredQRCodes(); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, campaign := range repo.campaigns {
+		if !s.storedQRCurrent(campaign) {
+			t.Errorf("%s: stored QR does not decode to the short link after the sync", id)
+		}
+	}
+	if len(repo.updated) != 2 {
+		t.Errorf("updated %v, want legacy and broken only", repo.updated)
+	}
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/workerpool"
+	"github.com/IMPHNEN/imphnen-backend-qr/pkg/exif"
+	"github.com/makiuchi-d/gozxing"
+	multiqr "github.com/makiuchi-d/gozxing/multi/qrcode"
+	"github.com/makiuchi-d/gozxing/qrcode"
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	CampaignStatusActive    = "active"
+	CampaignStatusScheduled = "scheduled"
+	CampaignStatusExpired   = "expired"
+	CampaignStatusInactive  = "inactive"
+
+	MatchedByShortCode = "short_code"
+	MatchedByURL       = "url"
+
+	// Uploads are first searched at most this many pixels on the longer side
+	decodeAnalysisSize = 2048
+)
+
+var (
+	// Short link path, also under a base URL with a path prefix
+	shortLinkPath = regexp.MustCompile(`/r/([A-Za-z0-9]+)/?$`)
+	// A payload holding only a short code (older codes are hex)
+	bareShortCode = regexp.MustCompile(`^[A-Za-z0-9]{4,16}$`)
+)
+
+// QRPoint is a position in the uploaded image, in pixels
+type QRPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// DecodedQR is a QR code found in an uploaded image. Points are the centers
+// of its finder patterns (plus the alignment pattern when one was found).
+// Campaigns is empty when the payload belongs to no campaign.
+type DecodedQR struct {
+	Payload   string             `json:"payload"`
+	Points    []QRPoint          `json:"points"`
+	Campaigns []*DecodedCampaign `json:"campaigns"`
+}
+
+// DecodedCampaign is a campaign matched by a decoded payload, either through
+// its short link or its destination URL.
+type DecodedCampaign struct {
+	*domain.QRCampaign
+	Status    string `json:"status"`
+	MatchedBy string `json:"matched_by"`
+}
+
+// DecodeImage finds every QR code in an uploaded image and matches each
+// payload against the campaigns. Decoding runs in the processing pool.
+func (s *QRCampaignService) DecodeImage(ctx context.Context, uploadedImage io.Reader) ([]*DecodedQR, error) {
+	data, err := s.limits.readImage(uploadedImage)
+	if err != nil {
+		return nil, err
+	}
+
+	var codes []*DecodedQR
+	err = s.pool.Do(ctx, func() error {
+		var err error
+		codes, err = locateQRCodes(data)
+		return err
+	})
+	if errors.Is(err, workerpool.ErrQueueFull) || errors.Is(err, workerpool.ErrQueueTimeout) {
+		return nil, fmt.Errorf("%w: %v", ErrServerBusy, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, code := range codes {
+		if code.Campaigns, err = s.matchCampaigns(code.Payload, now); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// locateQRCodes decodes an upload and returns the QR codes in it. Large
+// images are searched scaled down first, which is much faster and finds all
+// but the smallest codes; only when that finds nothing is the full
+// resolution searched. JPEGs are oriented first, so points match the image
+// as it is displayed.
+func locateQRCodes(data []byte) ([]*DecodedQR, error) {
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if format == ImageFormatJPEG {
+		if metadata := exif.FromJPEG(data); metadata != nil {
+			src = exif.Orient(src, exif.Orientation(metadata))
+		}
+	}
+
+	bounds := src.Bounds()
+	scale := math.Min(1, float64(decodeAnalysisSize)/float64(max(bounds.Dx(), bounds.Dy())))
+	var results []*gozxing.Result
+	if scale < 1 {
+		small := image.NewGray(image.Rect(0, 0, max(1, int(float64(bounds.Dx())*scale)), max(1, int(float64(bounds.Dy())*scale))))
+		xdraw.BiLinear.Scale(small, small.Bounds(), src, bounds, xdraw.Src, nil)
+		results = findQRCodes(small)
+	}
+	if len(results) == 0 {
+		scale = 1
+		results = findQRCodes(src)
+	}
+
+	codes := make([]*DecodedQR, 0, len(results))
+	for _, r := range results {
+		code := &DecodedQR{Payload: r.GetText(), Points: []QRPoint{}, Campaigns: []*DecodedCampaign{}}
+		for _, p := range r.GetResultPoints() {
+			code.Points = append(code.Points, QRPoint{
+				X: math.Round(p.GetX()/scale) + float64(bounds.Min.X),
+				Y: math.Round(p.GetY()/scale) + float64(bounds.Min.Y),
+			})
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// findQRCodes returns every QR code in img, including ones with light modules
+// on a dark background.
+func findQRCodes(img image.Image) []*gozxing.Result {
+	source := gozxing.NewLuminanceSourceFromImage(img)
+	hints := map[gozxing.DecodeHintType]interface{}{gozxing.DecodeHintType_TRY_HARDER: true}
+
+	var results []*gozxing.Result
+	for _, src := range []gozxing.LuminanceSource{source, source.Invert()} {
+		bitmap, err := gozxing.NewBinaryBitmap(gozxing.NewHybridBinarizer(src))
+		if err != nil {
+			continue
+		}
+		// Not finding any code is reported as an error
+		found, err := multiqr.NewQRCodeMultiReader().DecodeMultiple(bitmap, hints)
+		if err != nil {
+			continue
+		}
+		for _, r := range found {
+			if !containsQRCode(results, r) {
+				results = append(results, r)
+			}
+		}
+	}
+	return results
+}
+
+// containsQRCode reports whether r was already found, i.e. a result has the
+// same payload and lies within half a symbol of it.
+func containsQRCode(results []*gozxing.Result, r *gozxing.Result) bool {
+	cx, cy, size := resultGeometry(r)
+	for _, other := range results {
+		if other.GetText() != r.GetText() {
+			continue
+		}
+		ox, oy, _ := resultGeometry(other)
+		if math.Hypot(cx-ox, cy-oy) < size/2 {
+			return true
+		}
+	}
+	return false
+}
+
+// resultGeometry returns the center of a result's points and the distance
+// between its first two finder patterns, roughly the symbol size.
+func resultGeometry(r *gozxing.Result) (cx, cy, size float64) {
+	points := r.GetResultPoints()
+	if len(points) == 0 {
+		return 0, 0, 0
+	}
+	for _, p := range points {
+		cx += p.GetX()
+		cy += p.GetY()
+	}
+	cx /= float64(len(points))
+	cy /= float64(len(points))
+	if len(points) >= 2 {
+		size = math.Hypot(points[0].GetX()-points[1].GetX(), points[0].GetY()-points[1].GetY())
+	}
+	return cx, cy, size
+}
+
+// decodeQR reads a single QR code from img. Codes with light modules on a
+// dark background are tried inverted, as most phone scanners do.
+func decodeQR(img image.Image) (string, error) {
+	source := gozxing.NewLuminanceSourceFromImage(img)
+	hints := map[gozxing.DecodeHintType]interface{}{gozxing.DecodeHintType_TRY_HARDER: true}
+
+	var err error
+	for _, src := range []gozxing.LuminanceSource{source, source.Invert()} {
+		var bitmap *gozxing.BinaryBitmap
+		if bitmap, err = gozxing.NewBinaryBitmap(gozxing.NewHybridBinarizer(src)); err != nil {
+			continue
+		}
+		var result *gozxing.Result
+		if result, err = qrcode.NewQRCodeReader().Decode(bitmap, hints); err == nil {
+			return result.GetText(), nil
+		}
+	}
+	return "", err
+}
+
+// matchCampaigns finds the campaigns a payload belongs to. A short link
+// matches by its code whatever the host, so codes printed before a change of
+// PUBLIC_BASE_URL are still recognised; a bare short code matches too.
+// Otherwise the payload is compared with the campaigns' destination URLs,
+// which several campaigns may share, ignoring the case of the scheme and host
+// and a trailing slash on the path.
+func (s *QRCampaignService) matchCampaigns(payload string, now time.Time) ([]*DecodedCampaign, error) {
+	matches := []*DecodedCampaign{}
+	if code, ok := payloadShortCode(payload); ok {
+		campaign, err := s.repo.FindByShortCode(code)
+		if err != nil {
+			return nil, err
+		}
+		if campaign != nil {
+			return append(matches, &DecodedCampaign{campaign, campaignStatus(campaign, now), MatchedByShortCode}), nil
+		}
+	}
+
+	campaigns, err := s.repo.FindByURL(payload)
+	if err != nil {
+		return nil, err
+	}
+	for _, campaign := range campaigns {
+		matches = append(matches, &DecodedCampaign{campaign, campaignStatus(campaign, now), MatchedByURL})
+	}
+	return matches, nil
+}
+
+// payloadShortCode extracts the short code from a short link or a payload
+// that is only a code.
+func payloadShortCode(payload string) (string, bool) {
+	if bareShortCode.MatchString(payload) {
+		return payload, true
+	}
+	u, err := url.Parse(payload)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", false
+	}
+	m := shortLinkPath.FindStringSubmatch(u.Path)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// campaignStatus describes whether a campaign is live at now. Expiry is
+// checked first: the scheduler may not have deactivated an expired campaign
+// yet, but it is no longer served.
+func campaignStatus(campaign *domain.QRCampaign, now time.Time) string {
+	switch {
+	case campaign.IsExpired(now):
+		return CampaignStatusExpired
+	case campaign.IsActive:
+		return CampaignStatusActive
+	case campaign.StartsAt != nil && campaign.StartsAt.After(now):
+		return CampaignStatusScheduled
+	}
+	return CampaignStatusInactive
+}
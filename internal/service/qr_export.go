@@ -0,0 +1,393 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+	"github.com/IMPHNEN/imphnen-backend-qr/pkg/density"
+	"github.com/IMPHNEN/imphnen-backend-qr/pkg/pdf"
+)
+
+const (
+	QRFormatPNG = "png"
+	QRFormatSVG = "svg"
+	QRFormatPDF = "pdf"
+
+	QRLayoutSingle = "single"
+	QRLayoutSheet  = "sheet"
+
+	defaultSheetCopies = 12
+	maxSheetCopies     = 100
+
+	mmToPt          = 72 / 25.4
+	sheetMarginMM   = 10.0
+	sheetGapMM      = 8.0
+	cropMarkLenMM   = 3.0
+	cropMarkGapMM   = 1.0
+	cropMarkWidthPt = 0.25
+)
+
+var ErrInvalidExport = errors.New("invalid export options")
+
+// ExportQRInput selects the output of ExportQR. Layout and Copies only apply
+// to PDF; the sheet layout tiles Copies stickers on A4 with crop marks.
+// SizeMM is the printed side of the QR (quiet zone included); a PNG needs
+// DPI to render it, and a DPI alone prints the stored PNG at that density.
+type ExportQRInput struct {
+	Format string
+	Layout string
+	Copies int
+	SizeMM float64
+	DPI    int
+}
+
+type ExportedQR struct {
+	Data        []byte
+	ContentType string
+	Filename    string
+}
+
+// ExportQR returns the campaign's QR as PNG (the stored bitmap, or one
+// rendered for a physical size) or as SVG/PDF rendered from the module
+// matrix, honouring its colors, quiet zone and logo. Physical sizes are
+// checked against the minimum printed module size.
+func (s *QRCampaignService) ExportQR(id string, input ExportQRInput) (*ExportedQR, error) {
+	if input.Format == "" {
+		input.Format = QRFormatPNG
+	}
+	if input.Format != QRFormatPNG && input.Format != QRFormatSVG && input.Format != QRFormatPDF {
+		return nil, fmt.Errorf("%w: format must be png, svg or pdf", ErrInvalidExport)
+	}
+	if input.Layout == "" {
+		input.Layout = QRLayoutSingle
+	}
+	if input.Layout != QRLayoutSingle && input.Layout != QRLayoutSheet {
+		return nil, fmt.Errorf("%w: layout must be single or sheet", ErrInvalidExport)
+	}
+	if input.Layout == QRLayoutSheet && input.Format != QRFormatPDF {
+		return nil, fmt.Errorf("%w: sheet layout is only available as pdf", ErrInvalidExport)
+	}
+	if input.Copies == 0 {
+		input.Copies = defaultSheetCopies
+	}
+	if input.Copies < 1 || input.Copies > maxSheetCopies {
+		return nil, fmt.Errorf("%w: copies must be between 1 and %d", ErrInvalidExport, maxSheetCopies)
+	}
+	if input.SizeMM != 0 && !validPrintSize(input.SizeMM) {
+		return nil, fmt.Errorf("%w: size must be greater than 0 and at most %d mm", ErrInvalidExport, maxPrintSizeMM)
+	}
+	if !validDPI(input.DPI) {
+		return nil, fmt.Errorf("%w: dpi must be between %d and %d", ErrInvalidExport, minDPI, maxDPI)
+	}
+	if input.Format == QRFormatPNG && input.SizeMM > 0 && input.DPI == 0 {
+		return nil, fmt.Errorf("%w: a png with a physical size requires dpi", ErrInvalidExport)
+	}
+
+	campaign, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if campaign == nil {
+		return nil, ErrCampaignNotFound
+	}
+
+	// Printed size in millimetres, 0 when none was asked for
+	sizeMM := input.SizeMM
+	if sizeMM == 0 && input.DPI > 0 {
+		sizeMM = pixelsToMM(campaign.RenderOptions.Size, input.DPI)
+	}
+	if sizeMM > 0 {
+		if err := s.checkPrintSize(campaign, sizeMM, ErrInvalidExport); err != nil {
+			return nil, err
+		}
+	}
+
+	filename := "qr-" + campaign.ShortCode
+	if input.Format == QRFormatPNG {
+		data := campaign.QRCodeData
+		if input.SizeMM > 0 {
+			if data, err = s.renderPrintPNG(campaign, mmToPixels(input.SizeMM, input.DPI)); err != nil {
+				return nil, err
+			}
+		}
+		if input.DPI > 0 {
+			data = density.PNG(data, input.DPI)
+		}
+		return &ExportedQR{Data: data, ContentType: "image/png", Filename: filename + ".png"}, nil
+	}
+
+	matrix, err := qrMatrix(s.ShortURL(campaign.ShortCode), campaign.RenderOptions.ErrorCorrection)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Format == QRFormatSVG {
+		data, err := renderQRSVG(matrix, campaign.RenderOptions, campaign.LogoData, sizeMM)
+		if err != nil {
+			return nil, err
+		}
+		return &ExportedQR{Data: data, ContentType: "image/svg+xml", Filename: filename + ".svg"}, nil
+	}
+
+	var logo image.Image
+	if len(campaign.LogoData) > 0 {
+		if logo, err = decodeLogo(campaign.LogoData); err != nil {
+			return nil, err
+		}
+	}
+	copies := 1
+	if input.Layout == QRLayoutSheet {
+		copies = input.Copies
+		filename += "-sheet"
+	}
+	data, err := renderQRPDF(matrix, campaign.RenderOptions, logo, input.Layout, copies, sizeMM*mmToPt)
+	if err != nil {
+		return nil, err
+	}
+	return &ExportedQR{Data: data, ContentType: "application/pdf", Filename: filename + ".pdf"}, nil
+}
+
+// renderPrintPNG renders the campaign QR at size pixels for a physical export
+func (s *QRCampaignService) renderPrintPNG(campaign *domain.QRCampaign, size int) ([]byte, error) {
+	if size > s.limits.MaxDimension {
+		return nil, fmt.Errorf("%w: size is %dpx at this dpi, above the %dpx limit", ErrInvalidExport, size, s.limits.MaxDimension)
+	}
+	var logo image.Image
+	if len(campaign.LogoData) > 0 {
+		var err error
+		if logo, err = decodeLogo(campaign.LogoData); err != nil {
+			return nil, err
+		}
+	}
+	img, _, err := drawQR(s.ShortURL(campaign.ShortCode), campaign.RenderOptions, logo, size)
+	if err != nil {
+		return nil, err
+	}
+	return encodePNG(img)
+}
+
+// vectorLogoRect returns the logo plate and the aspect-fitted logo rectangle
+// in module units, relative to the top-left of the symbol.
+func vectorLogoRect(n int, logoW, logoH float64) (plateStart, plateSize float64, logoRect [4]float64) {
+	plate := logoPlateModules(n)
+	plateStart = float64((n - plate) / 2)
+	plateSize = float64(plate)
+
+	inner := plateSize - 2
+	scale := math.Min(inner/logoW, inner/logoH)
+	w, h := logoW*scale, logoH*scale
+	logoRect = [4]float64{plateStart + 1 + (inner-w)/2, plateStart + 1 + (inner-h)/2, w, h}
+	return plateStart, plateSize, logoRect
+}
+
+// renderQRSVG draws the matrix as a single path in module units. Horizontal
+// runs of dark modules are merged to keep the file small. A non-zero sizeMM
+// sets the document size in millimetres instead of pixels.
+func renderQRSVG(matrix [][]bool, opts domain.QRRenderOptions, logoData []byte, sizeMM float64) ([]byte, error) {
+	n := len(matrix)
+	q := opts.QuietZone
+	total := n + 2*q
+
+	side := strconv.Itoa(opts.Size)
+	if sizeMM > 0 {
+		side = pdf.Num(sizeMM) + "mm"
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 %d %d" width="%s" height="%s" shape-rendering="crispEdges">`+"\n",
+		total, total, side, side)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="%s"/>`+"\n", total, total, opts.BackgroundColor)
+
+	buf.WriteString(`<path fill="` + opts.ForegroundColor + `" d="`)
+	for y, row := range matrix {
+		for x := 0; x < n; {
+			if !row[x] {
+				x++
+				continue
+			}
+			run := 1
+			for x+run < n && row[x+run] {
+				run++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", x+q, y+q, run, run)
+			x += run
+		}
+	}
+	buf.WriteString(`"/>` + "\n")
+
+	if len(logoData) > 0 {
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(logoData))
+		if err != nil {
+			return nil, ErrInvalidLogo
+		}
+		plateStart, plateSize, rect := vectorLogoRect(n, float64(cfg.Width), float64(cfg.Height))
+		fmt.Fprintf(&buf, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s"/>`+"\n",
+			pdf.Num(plateStart+float64(q)), pdf.Num(plateStart+float64(q)), pdf.Num(plateSize), pdf.Num(plateSize), opts.BackgroundColor)
+		// SVG 2 reads href; xlink:href is for SVG 1.1 renderers such as
+		// older Inkscape and many print RIPs
+		uri := "data:" + http.DetectContentType(logoData) + ";base64," + base64.StdEncoding.EncodeToString(logoData)
+		fmt.Fprintf(&buf, `<image x="%s" y="%s" width="%s" height="%s" href="%s" xlink:href="%s"/>`+"\n",
+			pdf.Num(rect[0]+float64(q)), pdf.Num(rect[1]+float64(q)), pdf.Num(rect[2]), pdf.Num(rect[3]), uri, uri)
+	}
+
+	buf.WriteString("</svg>\n")
+	return buf.Bytes(), nil
+}
+
+// renderQRPDF renders either a single QR page or an A4 sheet of stickers with
+// crop marks. A non-zero side fixes the QR size in points; otherwise a single
+// page maps 1px of the configured size to 1pt and the sheet uses the largest
+// stickers that fit.
+func renderQRPDF(matrix [][]bool, opts domain.QRRenderOptions, logo image.Image, layout string, copies int, side float64) ([]byte, error) {
+	doc := pdf.New()
+	logoName := ""
+	if logo != nil {
+		logoName = doc.AddImage(logo)
+	}
+
+	var content bytes.Buffer
+	if layout == QRLayoutSingle {
+		if side == 0 {
+			side = float64(opts.Size)
+		}
+		writePDFQR(&content, matrix, opts, logo, logoName, 0, 0, side)
+		doc.AddPage(side, side, content.Bytes())
+		return doc.Bytes()
+	}
+
+	cols, rows, side, err := sheetGrid(copies, side)
+	if err != nil {
+		return nil, err
+	}
+	gap := sheetGapMM * mmToPt
+
+	// Center the grid on the page
+	gridW := float64(cols)*side + float64(cols-1)*gap
+	gridH := float64(rows)*side + float64(rows-1)*gap
+	left := (pdf.A4Width - gridW) / 2
+	top := pdf.A4Height - (pdf.A4Height-gridH)/2
+
+	for i := 0; i < copies; i++ {
+		col, row := i%cols, i/cols
+		x := left + float64(col)*(side+gap)
+		y := top - float64(row+1)*side - float64(row)*gap
+		writePDFQR(&content, matrix, opts, logo, logoName, x, y, side)
+		writeCropMarks(&content, x, y, side)
+	}
+
+	doc.AddPage(pdf.A4Width, pdf.A4Height, content.Bytes())
+	return doc.Bytes()
+}
+
+// sheetGrid picks the column count that gives the largest square stickers for
+// the given number of copies on an A4 page. With a fixed side (in points) it
+// fills rows as wide as they fit instead, and fails if the copies do not fit.
+func sheetGrid(copies int, fixed float64) (cols, rows int, side float64, err error) {
+	margin := sheetMarginMM * mmToPt
+	gap := sheetGapMM * mmToPt
+	usableW := pdf.A4Width - 2*margin
+	usableH := pdf.A4Height - 2*margin
+
+	if fixed > 0 {
+		cols = min(copies, int((usableW+gap)/(fixed+gap)))
+		maxRows := int((usableH + gap) / (fixed + gap))
+		if cols < 1 || maxRows < 1 {
+			return 0, 0, 0, fmt.Errorf("%w: a sticker of that size does not fit on an A4 sheet", ErrInvalidExport)
+		}
+		rows = (copies + cols - 1) / cols
+		if rows > maxRows {
+			return 0, 0, 0, fmt.Errorf("%w: at most %d stickers of that size fit on an A4 sheet", ErrInvalidExport, cols*maxRows)
+		}
+		return cols, rows, fixed, nil
+	}
+
+	for c := 1; c <= copies; c++ {
+		r := (copies + c - 1) / c
+		s := math.Min((usableW-float64(c-1)*gap)/float64(c), (usableH-float64(r-1)*gap)/float64(r))
+		if s > side {
+			cols, rows, side = c, r, s
+		}
+	}
+	return cols, rows, side, nil
+}
+
+// writePDFQR draws one QR (quiet zone included) with its bottom-left corner at
+// (x, y) and the given side length in points.
+func writePDFQR(w *bytes.Buffer, matrix [][]bool, opts domain.QRRenderOptions, logo image.Image, logoName string, x, y, side float64) {
+	n := len(matrix)
+	q := float64(opts.QuietZone)
+	unit := side / (float64(n) + 2*q)
+	fg, _ := parseHexColor(opts.ForegroundColor)
+	bg, _ := parseHexColor(opts.BackgroundColor)
+
+	// Module (mx, my) from the top-left maps to a PDF rectangle from the bottom-left
+	rect := func(mx, my, mw, mh float64) {
+		fmt.Fprintf(w, "%s %s %s %s re\n",
+			pdf.Num(x+(q+mx)*unit), pdf.Num(y+side-(q+my+mh)*unit), pdf.Num(mw*unit), pdf.Num(mh*unit))
+	}
+
+	fmt.Fprintf(w, "%s rg\n%s %s %s %s re f\n", pdfColor(bg), pdf.Num(x), pdf.Num(y), pdf.Num(side), pdf.Num(side))
+
+	fmt.Fprintf(w, "%s rg\n", pdfColor(fg))
+	for my, row := range matrix {
+		for mx := 0; mx < n; {
+			if !row[mx] {
+				mx++
+				continue
+			}
+			run := 1
+			for mx+run < n && row[mx+run] {
+				run++
+			}
+			rect(float64(mx), float64(my), float64(run), 1)
+			mx += run
+		}
+	}
+	w.WriteString("f\n")
+
+	if logo != nil {
+		lb := logo.Bounds()
+		plateStart, plateSize, lr := vectorLogoRect(n, float64(lb.Dx()), float64(lb.Dy()))
+		fmt.Fprintf(w, "%s rg\n", pdfColor(bg))
+		rect(plateStart, plateStart, plateSize, plateSize)
+		w.WriteString("f\n")
+		fmt.Fprintf(w, "q %s 0 0 %s %s %s cm /%s Do Q\n",
+			pdf.Num(lr[2]*unit), pdf.Num(lr[3]*unit),
+			pdf.Num(x+(q+lr[0])*unit), pdf.Num(y+side-(q+lr[1]+lr[3])*unit), logoName)
+	}
+}
+
+// writeCropMarks draws short cut guides outside each corner of a sticker
+func writeCropMarks(w *bytes.Buffer, x, y, side float64) {
+	l := cropMarkLenMM * mmToPt
+	g := cropMarkGapMM * mmToPt
+	fmt.Fprintf(w, "0 0 0 RG %s w\n", pdf.Num(cropMarkWidthPt))
+	for _, cx := range []float64{x, x + side} {
+		for _, cy := range []float64{y, y + side} {
+			dx := -1.0
+			if cx > x {
+				dx = 1
+			}
+			dy := -1.0
+			if cy > y {
+				dy = 1
+			}
+			// Horizontal and vertical mark extending away from the sticker
+			fmt.Fprintf(w, "%s %s m %s %s l S\n", pdf.Num(cx+dx*g), pdf.Num(cy), pdf.Num(cx+dx*(g+l)), pdf.Num(cy))
+			fmt.Fprintf(w, "%s %s m %s %s l S\n", pdf.Num(cx), pdf.Num(cy+dy*g), pdf.Num(cx), pdf.Num(cy+dy*(g+l)))
+		}
+	}
+}
+
+func pdfColor(c color.RGBA) string {
+	return fmt.Sprintf("%s %s %s", pdf.Num(float64(c.R)/255), pdf.Num(float64(c.G)/255), pdf.Num(float64(c.B)/255))
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+)
+
+func TestExportQRValidatesFirst(t *testing.T) {
+	// There is no campaign, so a lookup would fail with ErrCampaignNotFound
+	s := newTestService(&fakeCampaignRepo{})
+	for _, input := range []ExportQRInput{
+		{Format: "jpeg"},
+		{Format: "PDF"},
+		{Format: QRFormatSVG, Layout: QRLayoutSheet},
+		{Format: QRFormatPDF, Layout: QRLayoutSheet, Copies: maxSheetCopies + 1},
+		{Format: QRFormatPNG, SizeMM: 30},
+	} {
+		if _, err := s.ExportQR("c", input); !errors.Is(err, ErrInvalidExport) {
+			t.Errorf("%+v: err = %v, want ErrInvalidExport", input, err)
+		}
+	}
+}
+
+func TestExportQR(t *testing.T) {
+	campaign := testCampaign("c")
+	campaign.LogoData = testPhoto(t, 40, 30)
+	s := newTestService(&fakeCampaignRepo{campaigns: map[string]*domain.QRCampaign{"c": campaign}})
+
+	tests := []struct {
+		input       ExportQRInput
+		contentType string
+		filename    string
+	}{
+		{ExportQRInput{}, "image/png", "qr-abcd2345.png"},
+		{ExportQRInput{Format: QRFormatSVG, SizeMM: 30}, "image/svg+xml", "qr-abcd2345.svg"},
+		{ExportQRInput{Format: QRFormatPDF}, "application/pdf", "qr-abcd2345.pdf"},
+		{ExportQRInput{Format: QRFormatPDF, Layout: QRLayoutSheet, Copies: 4}, "application/pdf", "qr-abcd2345-sheet.pdf"},
+	}
+	for _, tt := range tests {
+		got, err := s.ExportQR("c", tt.input)
+		if err != nil {
+			t.Errorf("%+v: %v", tt.input, err)
+			continue
+		}
+		if got.ContentType != tt.contentType || got.Filename != tt.filename {
+			t.Errorf("%+v: %s %s, want %s %s", tt.input, got.ContentType, got.Filename, tt.contentType, tt.filename)
+		}
+	}
+
+	if _, err := s.ExportQR("missing", ExportQRInput{Format: QRFormatSVG}); !errors.Is(err, ErrCampaignNotFound) {
+		t.Errorf("missing campaign: err = %v, want ErrCampaignNotFound", err)
+	}
+}
+
+func TestRenderQRSVGLogo(t *testing.T) {
+	campaign := testCampaign("c")
+	matrix, err := qrMatrix("https://qr.example/r/"+campaign.ShortCode, "H")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := renderQRSVG(matrix, campaign.RenderOptions, testPhoto(t, 40, 30), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the xmlns:xlink declaration the attribute keeps the bare
+	// prefix as its namespace
+	var doc struct {
+		XMLName xml.Name
+		Images  []struct {
+			Attrs []xml.Attr `xml:",any,attr"`
+		} `xml:"image"`
+	}
+	if err := xml.NewDecoder(bytes.NewReader(data)).Decode(&doc); err != nil {
+		t.Fatalf("invalid svg: %v", err)
+	}
+	if len(doc.Images) != 1 {
+		t.Fatalf("%d images, want the logo", len(doc.Images))
+	}
+	hrefs := map[string]string{}
+	for _, attr := range doc.Images[0].Attrs {
+		if attr.Name.Local == "href" {
+			hrefs[attr.Name.Space] = attr.Value
+		}
+	}
+	plain, xlink := hrefs[""], hrefs["http://www.w3.org/1999/xlink"]
+	if !strings.HasPrefix(plain, "data:image/png;base64,") || xlink != plain {
+		t.Errorf("href %.40q, xlink:href %.40q: want the same PNG data URI", plain, xlink)
+	}
+}
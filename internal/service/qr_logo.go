@@ -0,0 +1,106 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	maxLogoBytes     = 2 << 20
+	maxLogoDimension = 4096
+
+	// Logo width relative to the QR symbol (excluding the quiet zone)
+	logoScale = 0.2
+	// Covered modules must stay well within what the level can recover
+	logoSafetyFactor = 2.5
+)
+
+var ErrInvalidLogo = errors.New("invalid logo, only PNG and JPEG up to 2 MB are supported")
+
+// Share of codewords each error correction level can restore
+var qrLevelCapacity = map[string]float64{
+	"L": 0.07,
+	"M": 0.15,
+	"Q": 0.25,
+	"H": 0.30,
+}
+
+// decodeLogo validates and decodes an uploaded PNG or JPEG logo
+func decodeLogo(data []byte) (image.Image, error) {
+	if len(data) == 0 || len(data) > maxLogoBytes {
+		return nil, ErrInvalidLogo
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (format != "png" && format != "jpeg") {
+		return nil, ErrInvalidLogo
+	}
+	if cfg.Width > maxLogoDimension || cfg.Height > maxLogoDimension {
+		return nil, ErrInvalidLogo
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidLogo
+	}
+	return img, nil
+}
+
+// logoPlateModules returns the side, in modules, of the centered square cleared
+// for the logo in an n x n symbol. It includes one module of padding per side.
+func logoPlateModules(n int) int {
+	plate := int(math.Round(float64(n)*logoScale)) + 2
+	// Keep the plate centered on the module grid
+	if (n-plate)%2 != 0 {
+		plate++
+	}
+	return plate
+}
+
+// requiredLogoLevel returns the lowest error correction level that can recover
+// the modules hidden behind the logo plate.
+func requiredLogoLevel(n int) string {
+	plate := float64(logoPlateModules(n))
+	coverage := plate * plate / float64(n*n)
+	for _, level := range []string{"L", "M", "Q", "H"} {
+		if qrLevelCapacity[level] >= coverage*logoSafetyFactor {
+			return level
+		}
+	}
+	return "H"
+}
+
+// compositeLogo clears a background-colored plate in the middle of the QR and
+// draws the logo inside it, preserving the logo's aspect ratio.
+func compositeLogo(qr image.Image, n int, opts domain.QRRenderOptions, logo image.Image) *image.RGBA {
+	bounds := qr.Bounds()
+	dst := image.NewRGBA(bounds)
+	draw.Draw(dst, bounds, qr, bounds.Min, draw.Src)
+
+	moduleSize, offset := qrLayout(n, opts, bounds.Dx())
+	plate := logoPlateModules(n)
+	start := offset + (n-plate)/2*moduleSize
+	plateRect := image.Rect(start, start, start+plate*moduleSize, start+plate*moduleSize)
+
+	bg, _ := parseHexColor(opts.BackgroundColor)
+	draw.Draw(dst, plateRect, image.NewUniform(bg), image.Point{}, draw.Src)
+
+	inner := plateRect.Inset(moduleSize)
+	lb := logo.Bounds()
+	scale := math.Min(float64(inner.Dx())/float64(lb.Dx()), float64(inner.Dy())/float64(lb.Dy()))
+	w := int(float64(lb.Dx()) * scale)
+	h := int(float64(lb.Dy()) * scale)
+	target := image.Rect(0, 0, w, h).Add(image.Pt(
+		inner.Min.X+(inner.Dx()-w)/2,
+		inner.Min.Y+(inner.Dy()-h)/2,
+	))
+
+	xdraw.CatmullRom.Scale(dst, target, logo, lb, xdraw.Over, nil)
+	return dst
+}
@@ -0,0 +1,637 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	OverlayTopLeft      = "top-left"
+	OverlayTopRight     = "top-right"
+	OverlayBottomLeft   = "bottom-left"
+	OverlayBottomRight  = "bottom-right"
+	OverlayTopCenter    = "top-center"
+	OverlayBottomCenter = "bottom-center"
+	OverlayCenterLeft   = "center-left"
+	OverlayCenterRight  = "center-right"
+	OverlayCenter       = "center"
+	OverlayCustom       = "custom"
+	// OverlayAuto picks the calmest corner or edge of each image (see
+	// autoPosition)
+	OverlayAuto = "auto"
+
+	// PlateAuto draws the plate in the QR background color
+	PlateAuto = "auto"
+
+	ResampleCrisp      = "crisp"
+	ResampleBilinear   = "bilinear"
+	ResampleCatmullRom = "catmull-rom"
+
+	minOverlaySizeRatio = 0.05
+	maxOverlaySizeRatio = 0.9
+	maxOverlayPadding   = 1000
+	minOverlayQRSize    = 100
+	minOverlayFitSize   = 32
+	maxPlateRadius      = 0.5
+	maxCaptionLength    = 64
+	// Height of the caption strip under the QR, relative to the QR size
+	captionHeightRatio = 0.2
+	// Quiet zone a plate guarantees around the QR, in modules
+	minQuietZoneModules = 4
+)
+
+var ErrInvalidOverlay = errors.New("invalid overlay options")
+
+// Coordinate is an overlay offset in pixels, or in percent of the free space
+// along that axis (0% is the left/top edge, 100% the right/bottom edge).
+type Coordinate struct {
+	Value   float64 `json:"value"`
+	Percent bool    `json:"percent"`
+}
+
+// ParseCoordinate parses "120" (pixels) or "25%" (percent).
+func ParseCoordinate(s string) (*Coordinate, error) {
+	s = strings.TrimSpace(s)
+	percent := strings.HasSuffix(s, "%")
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil, fmt.Errorf("%w: invalid coordinate %q", ErrInvalidOverlay, s)
+	}
+	return &Coordinate{Value: v, Percent: percent}, nil
+}
+
+// OverlayOptions controls where and how the QR is placed on an uploaded image.
+// Zero values (nil for pointers) mean "use the default". An empty PlateColor
+// disables the plate drawn behind the QR. Resample selects how the QR is
+// brought to the overlay size (see overlayQR). Caption is drawn under the QR,
+// with "{name}" replaced by the campaign name. PrintSize is the QR's printed
+// side in millimetres (quiet zone included); it replaces SizeRatio and needs
+// the output DPI to be converted to pixels.
+type OverlayOptions struct {
+	Position     string      `json:"position,omitempty"`
+	X            *Coordinate `json:"x,omitempty"`
+	Y            *Coordinate `json:"y,omitempty"`
+	SizeRatio    *float64    `json:"size_ratio,omitempty"`
+	Padding      *int        `json:"padding,omitempty"`
+	Opacity      *float64    `json:"opacity,omitempty"`
+	PlateColor   *string     `json:"plate_color,omitempty"`
+	PlateOpacity *float64    `json:"plate_opacity,omitempty"`
+	PlateRadius  *float64    `json:"plate_radius,omitempty"`
+	Caption      *string     `json:"caption,omitempty"`
+	CaptionColor *string     `json:"caption_color,omitempty"`
+	Resample     *string     `json:"resample,omitempty"`
+	PrintSize    *float64    `json:"print_size,omitempty"`
+	// Exact QR size in pixels, resolved from PrintSize by newOverlayLayer
+	sizePx int
+}
+
+// DefaultOverlayOptions matches the original bottom-right, 1/5 size placement.
+func DefaultOverlayOptions() OverlayOptions {
+	sizeRatio, padding, opacity, resample := 0.2, 10, 1.0, ResampleCrisp
+	plateColor, plateOpacity, plateRadius := "", 1.0, 0.0
+	caption, captionColor := "", ""
+	return OverlayOptions{
+		Position:     OverlayBottomRight,
+		SizeRatio:    &sizeRatio,
+		Padding:      &padding,
+		Opacity:      &opacity,
+		PlateColor:   &plateColor,
+		PlateOpacity: &plateOpacity,
+		PlateRadius:  &plateRadius,
+		Caption:      &caption,
+		CaptionColor: &captionColor,
+		Resample:     &resample,
+	}
+}
+
+// DefaultOverlayLayout is the stored form of DefaultOverlayOptions.
+func DefaultOverlayLayout() domain.OverlayLayout {
+	return domain.OverlayLayout{
+		Position:     OverlayBottomRight,
+		SizeRatio:    0.2,
+		Padding:      10,
+		PlateOpacity: 1,
+	}
+}
+
+// OverlayLayoutInput is the request form of domain.OverlayLayout. Unset
+// fields keep their current (or default) value; an empty plate_color removes
+// the plate and an empty caption removes the caption.
+type OverlayLayoutInput struct {
+	Position     string   `json:"position"`
+	X            *string  `json:"x"`
+	Y            *string  `json:"y"`
+	SizeRatio    *float64 `json:"size_ratio"`
+	Padding      *int     `json:"padding"`
+	PlateColor   *string  `json:"plate_color"`
+	PlateOpacity *float64 `json:"plate_opacity"`
+	PlateRadius  *float64 `json:"plate_radius"`
+	Caption      *string  `json:"caption"`
+	CaptionColor *string  `json:"caption_color"`
+}
+
+// normalizeOverlayLayout applies input on top of base and validates the result
+func normalizeOverlayLayout(input *OverlayLayoutInput, base domain.OverlayLayout) (domain.OverlayLayout, error) {
+	out := base
+	if input != nil {
+		if input.Position != "" {
+			out.Position = input.Position
+		}
+		if input.X != nil {
+			out.X = *input.X
+		}
+		if input.Y != nil {
+			out.Y = *input.Y
+		}
+		if input.SizeRatio != nil {
+			out.SizeRatio = *input.SizeRatio
+		}
+		if input.Padding != nil {
+			out.Padding = *input.Padding
+		}
+		if input.PlateColor != nil {
+			out.PlateColor = *input.PlateColor
+		}
+		if input.PlateOpacity != nil {
+			out.PlateOpacity = *input.PlateOpacity
+		}
+		if input.PlateRadius != nil {
+			out.PlateRadius = *input.PlateRadius
+		}
+		if input.Caption != nil {
+			out.Caption = strings.TrimSpace(*input.Caption)
+		}
+		if input.CaptionColor != nil {
+			out.CaptionColor = *input.CaptionColor
+		}
+	}
+	if out.Position != OverlayCustom {
+		out.X, out.Y = "", ""
+	}
+	if out.PlateColor != "" && out.PlateColor != PlateAuto {
+		c, err := parseHexColor(out.PlateColor)
+		if err != nil {
+			return out, fmt.Errorf("%w: plate_color %v", ErrInvalidOverlay, err)
+		}
+		out.PlateColor = formatHexColor(c)
+	}
+	if out.CaptionColor != "" {
+		c, err := parseHexColor(out.CaptionColor)
+		if err != nil {
+			return out, fmt.Errorf("%w: caption_color %v", ErrInvalidOverlay, err)
+		}
+		out.CaptionColor = formatHexColor(c)
+	}
+
+	opts, err := overlayFromLayout(out)
+	if err != nil {
+		return out, err
+	}
+	if err := opts.merge(DefaultOverlayOptions()).validate(); err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// overlayFromLayout converts a stored campaign layout to overlay options
+func overlayFromLayout(l domain.OverlayLayout) (OverlayOptions, error) {
+	opts := OverlayOptions{
+		Position:     l.Position,
+		SizeRatio:    &l.SizeRatio,
+		Padding:      &l.Padding,
+		PlateColor:   &l.PlateColor,
+		PlateOpacity: &l.PlateOpacity,
+		PlateRadius:  &l.PlateRadius,
+		Caption:      &l.Caption,
+		CaptionColor: &l.CaptionColor,
+	}
+	if l.X != "" {
+		x, err := ParseCoordinate(l.X)
+		if err != nil {
+			return opts, err
+		}
+		opts.X = x
+	}
+	if l.Y != "" {
+		y, err := ParseCoordinate(l.Y)
+		if err != nil {
+			return opts, err
+		}
+		opts.Y = y
+	}
+	return opts, nil
+}
+
+// merge returns o with unset fields taken from base
+func (o OverlayOptions) merge(base OverlayOptions) OverlayOptions {
+	out := base
+	if o.Position != "" {
+		out.Position = o.Position
+	}
+	if o.X != nil {
+		out.X = o.X
+	}
+	if o.Y != nil {
+		out.Y = o.Y
+	}
+	if o.SizeRatio != nil {
+		out.SizeRatio = o.SizeRatio
+	}
+	if o.Padding != nil {
+		out.Padding = o.Padding
+	}
+	if o.Opacity != nil {
+		out.Opacity = o.Opacity
+	}
+	if o.PlateColor != nil {
+		out.PlateColor = o.PlateColor
+	}
+	if o.PlateOpacity != nil {
+		out.PlateOpacity = o.PlateOpacity
+	}
+	if o.PlateRadius != nil {
+		out.PlateRadius = o.PlateRadius
+	}
+	if o.Caption != nil {
+		out.Caption = o.Caption
+	}
+	if o.CaptionColor != nil {
+		out.CaptionColor = o.CaptionColor
+	}
+	if o.Resample != nil {
+		out.Resample = o.Resample
+	}
+	if o.PrintSize != nil {
+		out.PrintSize = o.PrintSize
+	}
+	// Explicit coordinates without a position imply a custom placement
+	if o.Position == "" && (o.X != nil || o.Y != nil) {
+		out.Position = OverlayCustom
+	}
+	return out
+}
+
+func (o OverlayOptions) validate() error {
+	switch o.Position {
+	case OverlayTopLeft, OverlayTopRight, OverlayBottomLeft, OverlayBottomRight,
+		OverlayTopCenter, OverlayBottomCenter, OverlayCenterLeft, OverlayCenterRight,
+		OverlayCenter, OverlayAuto:
+	case OverlayCustom:
+		if o.X == nil || o.Y == nil {
+			return fmt.Errorf("%w: custom position requires x and y", ErrInvalidOverlay)
+		}
+	default:
+		return fmt.Errorf("%w: position must be one of top-left, top-right, bottom-left, bottom-right, top-center, bottom-center, center-left, center-right, center, custom, auto", ErrInvalidOverlay)
+	}
+	if o.SizeRatio == nil || !isFinite(*o.SizeRatio) || *o.SizeRatio < minOverlaySizeRatio || *o.SizeRatio > maxOverlaySizeRatio {
+		return fmt.Errorf("%w: size_ratio must be between %.2f and %.2f", ErrInvalidOverlay, minOverlaySizeRatio, maxOverlaySizeRatio)
+	}
+	if o.Padding == nil || *o.Padding < 0 || *o.Padding > maxOverlayPadding {
+		return fmt.Errorf("%w: padding must be between 0 and %d", ErrInvalidOverlay, maxOverlayPadding)
+	}
+	if o.Opacity == nil || !isFinite(*o.Opacity) || *o.Opacity <= 0 || *o.Opacity > 1 {
+		return fmt.Errorf("%w: opacity must be greater than 0 and at most 1", ErrInvalidOverlay)
+	}
+	if o.PlateColor != nil && *o.PlateColor != "" && *o.PlateColor != PlateAuto {
+		if _, err := parseHexColor(*o.PlateColor); err != nil {
+			return fmt.Errorf("%w: plate_color %v", ErrInvalidOverlay, err)
+		}
+	}
+	if o.PlateOpacity != nil && (!isFinite(*o.PlateOpacity) || *o.PlateOpacity <= 0 || *o.PlateOpacity > 1) {
+		return fmt.Errorf("%w: plate_opacity must be greater than 0 and at most 1", ErrInvalidOverlay)
+	}
+	if o.PlateRadius != nil && (!isFinite(*o.PlateRadius) || *o.PlateRadius < 0 || *o.PlateRadius > maxPlateRadius) {
+		return fmt.Errorf("%w: plate_radius must be between 0 and %g", ErrInvalidOverlay, maxPlateRadius)
+	}
+	if o.Caption != nil {
+		if utf8.RuneCountInString(*o.Caption) > maxCaptionLength {
+			return fmt.Errorf("%w: caption must be at most %d characters", ErrInvalidOverlay, maxCaptionLength)
+		}
+		if strings.IndexFunc(*o.Caption, unicode.IsControl) >= 0 {
+			return fmt.Errorf("%w: caption must not contain control characters", ErrInvalidOverlay)
+		}
+	}
+	if o.CaptionColor != nil && *o.CaptionColor != "" {
+		if _, err := parseHexColor(*o.CaptionColor); err != nil {
+			return fmt.Errorf("%w: caption_color %v", ErrInvalidOverlay, err)
+		}
+	}
+	if o.PrintSize != nil && !validPrintSize(*o.PrintSize) {
+		return fmt.Errorf("%w: qr_size must be greater than 0 and at most %d mm", ErrInvalidOverlay, maxPrintSizeMM)
+	}
+	if o.Resample != nil {
+		switch *o.Resample {
+		case ResampleCrisp, ResampleBilinear, ResampleCatmullRom:
+		default:
+			return fmt.Errorf("%w: resample must be one of crisp, bilinear, catmull-rom", ErrInvalidOverlay)
+		}
+	}
+	return nil
+}
+
+// isFinite rejects the NaN and infinities strconv.ParseFloat accepts, which
+// would pass range checks since every comparison with NaN is false.
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// overlayRect computes where the QR goes on a w x h image. The size and
+// padding are clamped so the QR, and the caption strip under it if any,
+// always lie fully inside the image.
+func overlayRect(w, h int, o OverlayOptions) (image.Rectangle, error) {
+	minDim := w
+	if h < minDim {
+		minDim = h
+	}
+
+	// Largest QR that fits with the given padding, leaving room for a caption
+	fit := func(padding int) int {
+		maxH := h - 2*padding
+		if hasCaption(o) {
+			maxH = int(float64(maxH) / (1 + captionHeightRatio))
+		}
+		return min(w-2*padding, maxH)
+	}
+
+	padding := *o.Padding
+	maxSize := fit(padding)
+	if maxSize < minOverlayFitSize {
+		// Drop the padding before giving up on small images
+		padding = 0
+		maxSize = fit(0)
+	}
+	if maxSize < minOverlayFitSize {
+		return image.Rectangle{}, fmt.Errorf("%w: image must be at least %dx%d pixels", ErrInvalidOverlay, minOverlayFitSize, minOverlayFitSize)
+	}
+
+	// Requested share of the smallest dimension, at least 100px when it fits
+	size := int(math.Round(float64(minDim) * *o.SizeRatio))
+	if size < minOverlayQRSize {
+		size = minOverlayQRSize
+	}
+	if size > maxSize {
+		size = maxSize
+	}
+	// A physical size is exact, so it is an error rather than shrunk to fit
+	if o.sizePx > 0 {
+		if o.sizePx > maxSize {
+			return image.Rectangle{}, fmt.Errorf("%w: qr_size is %dpx at this dpi, but at most %dpx fits on the image", ErrInvalidOverlay, o.sizePx, maxSize)
+		}
+		size = o.sizePx
+	}
+	// Vertical positions apply to the QR and caption together
+	height := size + captionHeight(size, o)
+
+	var x, y int
+	switch o.Position {
+	case OverlayTopLeft:
+		x, y = padding, padding
+	case OverlayTopRight:
+		x, y = w-size-padding, padding
+	case OverlayBottomLeft:
+		x, y = padding, h-height-padding
+	case OverlayBottomRight:
+		x, y = w-size-padding, h-height-padding
+	case OverlayTopCenter:
+		x, y = (w-size)/2, padding
+	case OverlayBottomCenter:
+		x, y = (w-size)/2, h-height-padding
+	case OverlayCenterLeft:
+		x, y = padding, (h-height)/2
+	case OverlayCenterRight:
+		x, y = w-size-padding, (h-height)/2
+	case OverlayCenter:
+		x, y = (w-size)/2, (h-height)/2
+	case OverlayCustom:
+		x = resolveCoordinate(*o.X, padding, w-size-padding)
+		y = resolveCoordinate(*o.Y, padding, h-height-padding)
+	}
+
+	return image.Rect(x, y, x+size, y+size), nil
+}
+
+func hasCaption(o OverlayOptions) bool {
+	return o.Caption != nil && *o.Caption != ""
+}
+
+// captionHeight is the height of the caption strip under a QR of size pixels
+func captionHeight(size int, o OverlayOptions) int {
+	if !hasCaption(o) {
+		return 0
+	}
+	return int(float64(size) * captionHeightRatio)
+}
+
+// resolveCoordinate converts c to a pixel offset clamped to [lo, hi], the
+// offsets that keep the QR padding away from both edges. A percentage is of
+// that range.
+func resolveCoordinate(c Coordinate, lo, hi int) int {
+	v := c.Value
+	if c.Percent {
+		v = float64(lo) + v/100*float64(hi-lo)
+	}
+	px := int(math.Round(v))
+	if px < lo {
+		return lo
+	}
+	if px > hi {
+		return hi
+	}
+	return px
+}
+
+// overlayQR returns the campaign QR at size x size pixels. ResampleCrisp
+// renders it from the module matrix so every module is a whole number of
+// pixels wide. The smooth modes scale the stored bitmap instead, which some
+// prefer for logo-bearing QRs; crisp falls back to Catmull-Rom when size is
+// too small to give every module a pixel.
+func (s *QRCampaignService) overlayQR(campaign *domain.QRCampaign, size int, mode string) (image.Image, error) {
+	if mode == ResampleCrisp {
+		var logo image.Image
+		if len(campaign.LogoData) > 0 {
+			var err error
+			if logo, err = decodeLogo(campaign.LogoData); err != nil {
+				return nil, err
+			}
+		}
+		img, _, err := drawQR(s.ShortURL(campaign.ShortCode), campaign.RenderOptions, logo, size)
+		if err == nil {
+			return img, nil
+		}
+		if !errors.Is(err, ErrInvalidRenderOptions) {
+			return nil, err
+		}
+		mode = ResampleCatmullRom
+	}
+
+	stored, err := png.Decode(bytes.NewReader(campaign.QRCodeData))
+	if err != nil {
+		return nil, err
+	}
+	var interp xdraw.Interpolator = xdraw.CatmullRom
+	if mode == ResampleBilinear {
+		interp = xdraw.BiLinear
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	interp.Scale(dst, dst.Bounds(), stored, stored.Bounds(), xdraw.Src, nil)
+	return dst, nil
+}
+
+// overlayLayer is the campaign QR, with the plate behind it and the caption
+// under it if any, placed on an image. It is built once and can be drawn on
+// any number of canvases.
+type overlayLayer struct {
+	// position actually used, with auto resolved
+	position string
+	qr       image.Image
+	qrRect   image.Rectangle
+	mask     image.Image
+	// plateMask and captionMask already include the opacity
+	plate       image.Image
+	plateRect   image.Rectangle
+	plateMask   *image.Alpha
+	caption     image.Image
+	captionRect image.Rectangle
+	captionMask *image.Alpha
+	// colors the layer draws at full opacity, kept exact when quantizing
+	colors []color.Color
+}
+
+// newOverlayLayer places the campaign QR on src. src is only looked at to
+// resolve the auto position and pick a caption color. A non-zero dpi sizes a
+// PrintSize QR and enforces the minimum printed module size.
+func (s *QRCampaignService) newOverlayLayer(campaign *domain.QRCampaign, src image.Image, overlay OverlayOptions, dpi int) (*overlayLayer, error) {
+	bounds := src.Bounds()
+	if overlay.PrintSize != nil && dpi > 0 {
+		overlay.sizePx = max(1, mmToPixels(*overlay.PrintSize, dpi))
+	}
+	if overlay.Position == OverlayAuto {
+		position, err := autoPosition(src, overlay)
+		if err != nil {
+			return nil, err
+		}
+		overlay.Position = position
+	}
+
+	qrRect, err := overlayRect(bounds.Dx(), bounds.Dy(), overlay)
+	if err != nil {
+		return nil, err
+	}
+	var margin int
+	if *overlay.PlateColor != "" {
+		// Padding is measured from the plate, so it is not clipped at the edge
+		margin = s.plateMargin(campaign, qrRect.Dx())
+		padding := *overlay.Padding + margin
+		overlay.Padding = &padding
+		if qrRect, err = overlayRect(bounds.Dx(), bounds.Dy(), overlay); err != nil {
+			return nil, err
+		}
+		margin = s.plateMargin(campaign, qrRect.Dx())
+	}
+	qrRect = qrRect.Add(bounds.Min)
+	if dpi > 0 {
+		if err := s.checkPrintSize(campaign, pixelsToMM(qrRect.Dx(), dpi), ErrInvalidOverlay); err != nil {
+			return nil, err
+		}
+	}
+
+	qrImg, err := s.overlayQR(campaign, qrRect.Dx(), *overlay.Resample)
+	if err != nil {
+		return nil, err
+	}
+
+	opacity := *overlay.Opacity
+	layer := &overlayLayer{
+		position: overlay.Position,
+		qr:       qrImg,
+		qrRect:   qrRect,
+		mask:     image.NewUniform(color.Alpha{A: uint8(math.Round(opacity * 255))}),
+	}
+	fg, _ := parseHexColor(campaign.RenderOptions.ForegroundColor)
+	bg, _ := parseHexColor(campaign.RenderOptions.BackgroundColor)
+	layer.colors = []color.Color{fg, bg}
+	content := qrRect
+
+	var plate *color.RGBA
+	if *overlay.PlateColor != "" {
+		c := bg
+		if *overlay.PlateColor != PlateAuto {
+			c, _ = parseHexColor(*overlay.PlateColor)
+		}
+		plate = &c
+		layer.plate = image.NewUniform(c)
+		layer.colors = append(layer.colors, c)
+	}
+
+	if hasCaption(overlay) {
+		text := strings.ReplaceAll(*overlay.Caption, "{name}", campaign.Name)
+		layer.captionRect = image.Rect(qrRect.Min.X, qrRect.Max.Y, qrRect.Max.X, qrRect.Max.Y+captionHeight(qrRect.Dx(), overlay))
+		layer.captionMask = renderCaption(text, layer.captionRect, opacity)
+
+		var c color.RGBA
+		switch {
+		case *overlay.CaptionColor != "":
+			c, _ = parseHexColor(*overlay.CaptionColor)
+		case plate != nil:
+			c = contrastingColor(*plate, fg)
+		default:
+			c = contrastingColor(averageColor(src, layer.captionRect), fg)
+		}
+		layer.caption = image.NewUniform(c)
+		layer.colors = append(layer.colors, c)
+		content = content.Union(layer.captionRect)
+	}
+
+	if plate != nil {
+		layer.plateRect = content.Inset(-margin).Intersect(bounds)
+		radius := *overlay.PlateRadius * float64(min(layer.plateRect.Dx(), layer.plateRect.Dy()))
+		radius = math.Min(radius, maxCornerRadius(layer.plateRect, content))
+		layer.plateMask = roundedRectMask(layer.plateRect, radius, opacity**overlay.PlateOpacity)
+	}
+	return layer, nil
+}
+
+// plateMargin is the plate's margin around the QR: 1/16 of the QR size, and
+// enough to make up a 4-module quiet zone when the QR's own is narrower.
+func (s *QRCampaignService) plateMargin(campaign *domain.QRCampaign, size int) int {
+	margin := max(size/16, 2)
+	opts := campaign.RenderOptions
+	if opts.QuietZone >= minQuietZoneModules {
+		return margin
+	}
+	matrix, err := qrMatrix(s.ShortURL(campaign.ShortCode), opts.ErrorCorrection)
+	if err != nil {
+		return margin
+	}
+	moduleSize := float64(size) / float64(len(matrix)+2*opts.QuietZone)
+	return max(margin, int(math.Ceil(float64(minQuietZoneModules-opts.QuietZone)*moduleSize)))
+}
+
+// Bounds covers every pixel the layer draws
+func (l *overlayLayer) Bounds() image.Rectangle {
+	return l.qrRect.Union(l.plateRect).Union(l.captionRect)
+}
+
+// drawOn draws the plate, QR and caption with the requested opacity
+func (l *overlayLayer) drawOn(dst draw.Image) {
+	if l.plate != nil {
+		draw.DrawMask(dst, l.plateRect, l.plate, image.Point{}, l.plateMask, l.plateRect.Min, draw.Over)
+	}
+	draw.DrawMask(dst, l.qrRect, l.qr, l.qr.Bounds().Min, l.mask, image.Point{}, draw.Over)
+	if l.caption != nil {
+		draw.DrawMask(dst, l.captionRect, l.caption, image.Point{}, l.captionMask, l.captionRect.Min, draw.Over)
+	}
+}
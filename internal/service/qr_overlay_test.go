@@ -0,0 +1,139 @@
+package service
+
+import (
+	"errors"
+	"image"
+	"testing"
+)
+
+func TestOverlayRect(t *testing.T) {
+	ratio := func(r float64) func(*OverlayOptions) {
+		return func(o *OverlayOptions) { o.SizeRatio = &r }
+	}
+	padding := func(p int) func(*OverlayOptions) {
+		return func(o *OverlayOptions) { o.Padding = &p }
+	}
+	custom := func(x, y string) func(*OverlayOptions) {
+		return func(o *OverlayOptions) {
+			o.Position = OverlayCustom
+			o.X, _ = ParseCoordinate(x)
+			o.Y, _ = ParseCoordinate(y)
+		}
+	}
+	printSize := func(px int) func(*OverlayOptions) {
+		return func(o *OverlayOptions) { o.sizePx = px }
+	}
+
+	tests := []struct {
+		name     string
+		w, h     int
+		position string
+		edits    []func(*OverlayOptions)
+		want     image.Rectangle
+		wantErr  bool
+	}{
+		{"bottom-right", 1000, 800, OverlayBottomRight, nil, image.Rect(830, 630, 990, 790), false},
+		{"top-left", 1000, 800, OverlayTopLeft, nil, image.Rect(10, 10, 170, 170), false},
+		{"center", 1000, 800, OverlayCenter, nil, image.Rect(420, 320, 580, 480), false},
+		{"minimum size", 300, 200, OverlayBottomRight, nil, image.Rect(190, 90, 290, 190), false},
+		{"clamped to the image", 300, 200, OverlayBottomRight, []func(*OverlayOptions){ratio(0.9)}, image.Rect(110, 10, 290, 190), false},
+		{"padding clamps the size", 300, 200, OverlayTopLeft, []func(*OverlayOptions){ratio(0.9), padding(40)}, image.Rect(40, 40, 160, 160), false},
+		{"padding dropped on small images", 50, 40, OverlayBottomRight, nil, image.Rect(10, 0, 50, 40), false},
+		{"padding larger than the image", 300, 200, OverlayTopRight, []func(*OverlayOptions){padding(1000)}, image.Rect(200, 0, 300, 100), false},
+		{"too small", 20, 20, OverlayBottomRight, nil, image.Rectangle{}, true},
+		{"custom pixels and percent", 1000, 800, "", []func(*OverlayOptions){custom("120", "25%")}, image.Rect(120, 165, 280, 325), false},
+		{"custom before the edge", 1000, 800, "", []func(*OverlayOptions){custom("-50", "0%")}, image.Rect(10, 10, 170, 170), false},
+		{"custom past the edge", 1000, 800, "", []func(*OverlayOptions){custom("5000", "100%")}, image.Rect(830, 630, 990, 790), false},
+		{"custom without padding", 1000, 800, "", []func(*OverlayOptions){custom("0", "100%"), padding(0)}, image.Rect(0, 640, 160, 800), false},
+		{"print size", 1000, 800, OverlayTopLeft, []func(*OverlayOptions){printSize(300)}, image.Rect(10, 10, 310, 310), false},
+		{"print size too large", 1000, 800, OverlayTopLeft, []func(*OverlayOptions){printSize(781)}, image.Rectangle{}, true},
+	}
+	for _, tt := range tests {
+		o := DefaultOverlayOptions()
+		if tt.position != "" {
+			o.Position = tt.position
+		}
+		for _, edit := range tt.edits {
+			edit(&o)
+		}
+
+		got, err := overlayRect(tt.w, tt.h, o)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidOverlay) {
+				t.Errorf("%s: err = %v, want ErrInvalidOverlay", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: rect = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOverlayRectCaption(t *testing.T) {
+	caption := "Scan me"
+	for _, position := range autoCandidates {
+		o := DefaultOverlayOptions()
+		o.Position = position
+		ratio := 0.9
+		o.SizeRatio = &ratio
+		o.Caption = &caption
+
+		rect, err := overlayRect(500, 500, o)
+		if err != nil {
+			t.Fatalf("%s: %v", position, err)
+		}
+		content := rect.Union(image.Rect(rect.Min.X, rect.Max.Y, rect.Max.X, rect.Max.Y+captionHeight(rect.Dx(), o)))
+		if !content.In(image.Rect(10, 10, 490, 490)) {
+			t.Errorf("%s: QR and caption %v are not inside the padding", position, content)
+		}
+	}
+}
+
+func TestOverlayLayerPlate(t *testing.T) {
+	s := newTestService(&fakeCampaignRepo{})
+	campaign := testCampaign("c")
+	src := image.NewRGBA(image.Rect(0, 0, 1000, 800))
+	bounds := src.Bounds()
+
+	tests := []struct {
+		name     string
+		position string
+		x, y     string
+		padding  int
+	}{
+		{"corner", OverlayBottomRight, "", "", 10},
+		{"corner without padding", OverlayTopLeft, "", "", 0},
+		{"custom at the origin", OverlayCustom, "0", "0", 10},
+		{"custom past the far edge", OverlayCustom, "100%", "5000", 10},
+		{"custom without padding", OverlayCustom, "-20", "100%", 0},
+	}
+	for _, tt := range tests {
+		o := DefaultOverlayOptions()
+		o.Position = tt.position
+		if tt.position == OverlayCustom {
+			o.X, _ = ParseCoordinate(tt.x)
+			o.Y, _ = ParseCoordinate(tt.y)
+		}
+		plate := PlateAuto
+		o.PlateColor = &plate
+		o.Padding = &tt.padding
+
+		layer, err := s.newOverlayLayer(campaign, src, o, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		// The plate is the margin around the QR, padding away from the edges
+		margin := s.plateMargin(campaign, layer.qrRect.Dx())
+		if want := layer.qrRect.Inset(-margin); layer.plateRect != want {
+			t.Errorf("%s: plate %v, want %v around QR %v", tt.name, layer.plateRect, want, layer.qrRect)
+		}
+		if inner := bounds.Inset(tt.padding); !layer.plateRect.In(inner) {
+			t.Errorf("%s: plate %v is not inside %v", tt.name, layer.plateRect, inner)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"image"
+	"math"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	// Images are analysed at most this many pixels on the longer side
+	autoAnalysisSize = 256
+	// Sobel magnitude (|gx|+|gy|, 0-2040) above which a pixel counts as an edge
+	autoEdgeThreshold = 96
+	// Weight of edge density against luminance variance in a region's score
+	autoEdgeWeight = 0.6
+)
+
+// autoCandidates are the positions auto chooses from. On a tie the earlier one
+// wins, so a uniform image keeps the default bottom-right placement.
+var autoCandidates = []string{
+	OverlayBottomRight, OverlayBottomLeft, OverlayTopRight, OverlayTopLeft,
+	OverlayBottomCenter, OverlayTopCenter, OverlayCenterRight, OverlayCenterLeft,
+}
+
+// autoPosition returns the candidate position where the QR would cover the
+// least detail. Each region is scored by its edge density (share of pixels
+// on a Sobel edge) and luminance variance, both relative to the busiest
+// candidate, so faces and text score high and sky or walls score low.
+func autoPosition(src image.Image, overlay OverlayOptions) (string, error) {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	gray, scale := analysisImage(src)
+	edges := sobelEdges(gray)
+
+	type regionStats struct{ edges, variance float64 }
+	stats := make([]regionStats, len(autoCandidates))
+	var maxEdges, maxVariance float64
+	for i, position := range autoCandidates {
+		o := overlay
+		o.Position = position
+		rect, err := overlayRect(w, h, o)
+		if err != nil {
+			return "", err
+		}
+		r := image.Rect(
+			int(float64(rect.Min.X)*scale), int(float64(rect.Min.Y)*scale),
+			int(math.Ceil(float64(rect.Max.X)*scale)), int(math.Ceil(float64(rect.Max.Y)*scale)),
+		).Intersect(gray.Bounds())
+
+		stats[i].edges, stats[i].variance = regionDetail(gray, edges, r)
+		maxEdges = math.Max(maxEdges, stats[i].edges)
+		maxVariance = math.Max(maxVariance, stats[i].variance)
+	}
+
+	best, bestScore := autoCandidates[0], math.Inf(1)
+	for i, st := range stats {
+		var score float64
+		if maxEdges > 0 {
+			score += autoEdgeWeight * st.edges / maxEdges
+		}
+		if maxVariance > 0 {
+			score += (1 - autoEdgeWeight) * st.variance / maxVariance
+		}
+		if score < bestScore {
+			best, bestScore = autoCandidates[i], score
+		}
+	}
+	return best, nil
+}
+
+// analysisImage returns src in grayscale, scaled down to at most
+// autoAnalysisSize pixels on the longer side, and the scale factor used.
+func analysisImage(src image.Image) (*image.Gray, float64) {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	scale := math.Min(1, float64(autoAnalysisSize)/float64(max(w, h)))
+	gray := image.NewGray(image.Rect(0, 0, max(1, int(float64(w)*scale)), max(1, int(float64(h)*scale))))
+	xdraw.ApproxBiLinear.Scale(gray, gray.Bounds(), src, bounds, xdraw.Src, nil)
+	return gray, scale
+}
+
+// sobelEdges marks the pixels of img whose gradient magnitude exceeds
+// autoEdgeThreshold. Border pixels are never edges.
+func sobelEdges(img *image.Gray) []bool {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	edges := make([]bool, w*h)
+	at := func(x, y int) int { return int(img.Pix[y*img.Stride+x]) }
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			gx := at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+			gy := at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+			if abs(gx)+abs(gy) > autoEdgeThreshold {
+				edges[y*w+x] = true
+			}
+		}
+	}
+	return edges
+}
+
+// regionDetail returns the edge density and luminance variance of r
+func regionDetail(img *image.Gray, edges []bool, r image.Rectangle) (density, variance float64) {
+	n := float64(r.Dx() * r.Dy())
+	if n == 0 {
+		return 0, 0
+	}
+	w := img.Rect.Dx()
+	var edgeCount, sum, sumSq float64
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if edges[y*w+x] {
+				edgeCount++
+			}
+			v := float64(img.Pix[y*img.Stride+x])
+			sum += v
+			sumSq += v * v
+		}
+	}
+	mean := sum / n
+	return edgeCount / n, sumSq/n - mean*mean
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// busyImage is a flat gray w x h image with a fine checkerboard, standing in
+// for faces or text, in each of the busy rectangles
+func busyImage(w, h int, busy ...image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 128, G: 140, B: 150, A: 255}
+			for _, r := range busy {
+				if image.Pt(x, y).In(r) && (x/6+y/6)%2 == 0 {
+					c = color.RGBA{R: 20, G: 20, B: 20, A: 255}
+				}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestAutoPosition(t *testing.T) {
+	const w, h = 800, 600
+	topLeft := image.Rect(0, 0, w/2, h/2)
+	topRight := image.Rect(w/2, 0, w, h/2)
+	bottomLeft := image.Rect(0, h/2, w/2, h)
+	bottomRight := image.Rect(w/2, h/2, w, h)
+
+	tests := []struct {
+		name string
+		busy []image.Rectangle
+		want string
+	}{
+		{"uniform keeps the default", nil, OverlayBottomRight},
+		{"busy bottom-right", []image.Rectangle{bottomRight}, OverlayBottomLeft},
+		{"busy top-left", []image.Rectangle{topLeft}, OverlayBottomRight},
+		{"busy bottom half", []image.Rectangle{bottomLeft, bottomRight}, OverlayTopRight},
+		{"only top-left is quiet", []image.Rectangle{topRight, bottomLeft, bottomRight}, OverlayTopLeft},
+		{"only the top edge is quiet", []image.Rectangle{image.Rect(0, 150, w, h)}, OverlayTopRight},
+	}
+	for _, tt := range tests {
+		got, err := autoPosition(busyImage(w, h, tt.busy...), DefaultOverlayOptions())
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: position %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAutoPositionSubImage(t *testing.T) {
+	// A cropped image keeps the coordinates of the original
+	img := busyImage(1000, 800, image.Rect(600, 500, 1000, 800))
+	sub := img.SubImage(image.Rect(200, 200, 1000, 800))
+	got, err := autoPosition(sub, DefaultOverlayOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != OverlayBottomLeft {
+		t.Errorf("position %q, want %q", got, OverlayBottomLeft)
+	}
+}
+
+func TestSobelEdges(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 8, 4))
+	for y := 0; y < 4; y++ {
+		for x := 4; x < 8; x++ {
+			img.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	edges := sobelEdges(img)
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 8; x++ {
+			// The step between columns 3 and 4 is found on both sides, but
+			// never on the border rows and columns
+			want := (x == 3 || x == 4) && y > 0 && y < 3
+			if edges[y*8+x] != want {
+				t.Errorf("edge at (%d,%d) = %v, want %v", x, y, edges[y*8+x], want)
+			}
+		}
+	}
+}
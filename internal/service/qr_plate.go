@@ -0,0 +1,134 @@
+package service
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const minCaptionFontSize = 6
+
+var (
+	captionFontOnce sync.Once
+	captionFont     *opentype.Font
+	captionFontErr  error
+)
+
+// loadCaptionFont parses the embedded Go Bold font once
+func loadCaptionFont() (*opentype.Font, error) {
+	captionFontOnce.Do(func() {
+		captionFont, captionFontErr = opentype.Parse(gobold.TTF)
+	})
+	return captionFont, captionFontErr
+}
+
+// roundedRectMask returns an alpha mask covering r with corners of the given
+// radius, antialiased, at the given opacity.
+func roundedRectMask(r image.Rectangle, radius, opacity float64) *image.Alpha {
+	mask := image.NewAlpha(r)
+	w, h := r.Dx(), r.Dy()
+	alpha := opacity * 255
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			coverage := 1.0
+			// Distance from the pixel center to the nearest corner arc center
+			cx := math.Max(radius-(float64(x)+0.5), (float64(x)+0.5)-(float64(w)-radius))
+			cy := math.Max(radius-(float64(y)+0.5), (float64(y)+0.5)-(float64(h)-radius))
+			if cx > 0 && cy > 0 {
+				coverage = math.Max(0, math.Min(1, radius+0.5-math.Hypot(cx, cy)))
+			}
+			mask.Pix[y*mask.Stride+x] = uint8(math.Round(coverage * alpha))
+		}
+	}
+	return mask
+}
+
+// maxCornerRadius is the largest corner radius of plate whose arcs stay clear
+// of content, so rounding never cuts into the QR or the quiet zone the
+// plate's margin provides. With margin m, the content corner pixel center
+// lies (r-m-0.5)*sqrt2 from the arc center and must be within r-0.5 of it
+// to be fully covered.
+func maxCornerRadius(plate, content image.Rectangle) float64 {
+	m := min(content.Min.X-plate.Min.X, content.Min.Y-plate.Min.Y,
+		plate.Max.X-content.Max.X, plate.Max.Y-content.Max.Y)
+	m = max(m, 0)
+	return (math.Sqrt2*(float64(m)+0.5) - 0.5) / (math.Sqrt2 - 1)
+}
+
+// renderCaption draws text centered in r and returns its coverage at the
+// given opacity. The font is sized to the strip's height and shrunk until the
+// text fits its width; text that still does not fit is clipped.
+func renderCaption(text string, r image.Rectangle, opacity float64) *image.Alpha {
+	mask := image.NewAlpha(r)
+	f, err := loadCaptionFont()
+	if err != nil {
+		return mask
+	}
+
+	size := float64(r.Dy()) * 0.7
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return mask
+	}
+	// Leave a little room on both sides
+	maxWidth := float64(r.Dx()) * 0.95
+	if width := float64(font.MeasureString(face, text)) / 64; width > maxWidth {
+		face.Close()
+		size = math.Max(minCaptionFontSize, size*maxWidth/width)
+		if face, err = opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull}); err != nil {
+			return mask
+		}
+	}
+	defer face.Close()
+
+	metrics := face.Metrics()
+	width := font.MeasureString(face, text)
+	d := &font.Drawer{
+		Dst:  mask,
+		Src:  image.NewUniform(color.Alpha{A: uint8(math.Round(opacity * 255))}),
+		Face: face,
+		Dot: fixed.Point26_6{
+			X: fixed.I(r.Min.X) + (fixed.I(r.Dx())-width)/2,
+			Y: fixed.I(r.Min.Y) + (fixed.I(r.Dy())+metrics.Ascent-metrics.Descent)/2,
+		},
+	}
+	d.DrawString(text)
+	return mask
+}
+
+// contrastingColor returns whichever of preferred, black and white contrasts
+// most with background. preferred wins whenever it is readable.
+func contrastingColor(background, preferred color.RGBA) color.RGBA {
+	if contrastRatio(background, preferred) >= minQRContrast {
+		return preferred
+	}
+	black, white := color.RGBA{A: 255}, color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	if contrastRatio(background, black) >= contrastRatio(background, white) {
+		return black
+	}
+	return white
+}
+
+// averageColor returns the mean color of img within r, sampling at most
+// about 64x64 pixels.
+func averageColor(img image.Image, r image.Rectangle) color.RGBA {
+	r = r.Intersect(img.Bounds())
+	if r.Empty() {
+		return color.RGBA{A: 255}
+	}
+	step := max(1, max(r.Dx(), r.Dy())/64)
+	var sr, sg, sb, n uint64
+	for y := r.Min.Y; y < r.Max.Y; y += step {
+		for x := r.Min.X; x < r.Max.X; x += step {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			sr, sg, sb, n = sr+uint64(c.R), sg+uint64(c.G), sb+uint64(c.B), n+1
+		}
+	}
+	return color.RGBA{R: uint8(sr / n), G: uint8(sg / n), B: uint8(sb / n), A: 255}
+}
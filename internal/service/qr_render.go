@@ -0,0 +1,230 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const (
+	minQRSize      = 128
+	maxQRSize      = 2048
+	maxQuietZone   = 16
+	minQRContrast  = 4.5
+	defaultQRSize  = 256
+	defaultQuietZ  = 4
+	defaultQRLevel = "M"
+)
+
+var ErrInvalidRenderOptions = errors.New("invalid render options")
+
+var qrLevels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// DefaultRenderOptions matches the original 256px, medium recovery, black on
+// white rendering.
+func DefaultRenderOptions() domain.QRRenderOptions {
+	return domain.QRRenderOptions{
+		ErrorCorrection: defaultQRLevel,
+		Size:            defaultQRSize,
+		QuietZone:       defaultQuietZ,
+		ForegroundColor: "#000000",
+		BackgroundColor: "#FFFFFF",
+	}
+}
+
+// RenderOptionsInput is the request form of domain.QRRenderOptions. Unset
+// fields keep their current (or default) value.
+type RenderOptionsInput struct {
+	ErrorCorrection string `json:"error_correction"`
+	Size            int    `json:"size"`
+	QuietZone       *int   `json:"quiet_zone"`
+	ForegroundColor string `json:"foreground_color"`
+	BackgroundColor string `json:"background_color"`
+}
+
+// normalizeRenderOptions fills unset fields from base and validates the result.
+// Colors are normalized to upper-case #RRGGBB.
+func normalizeRenderOptions(opts *RenderOptionsInput, base domain.QRRenderOptions) (domain.QRRenderOptions, error) {
+	out := base
+	if opts != nil {
+		if opts.ErrorCorrection != "" {
+			out.ErrorCorrection = strings.ToUpper(opts.ErrorCorrection)
+		}
+		if opts.Size != 0 {
+			out.Size = opts.Size
+		}
+		if opts.QuietZone != nil {
+			out.QuietZone = *opts.QuietZone
+		}
+		if opts.ForegroundColor != "" {
+			out.ForegroundColor = opts.ForegroundColor
+		}
+		if opts.BackgroundColor != "" {
+			out.BackgroundColor = opts.BackgroundColor
+		}
+	}
+
+	if _, ok := qrLevels[out.ErrorCorrection]; !ok {
+		return out, fmt.Errorf("%w: error_correction must be one of L, M, Q, H", ErrInvalidRenderOptions)
+	}
+	if out.Size < minQRSize || out.Size > maxQRSize {
+		return out, fmt.Errorf("%w: size must be between %d and %d pixels", ErrInvalidRenderOptions, minQRSize, maxQRSize)
+	}
+	if out.QuietZone < 0 || out.QuietZone > maxQuietZone {
+		return out, fmt.Errorf("%w: quiet_zone must be between 0 and %d modules", ErrInvalidRenderOptions, maxQuietZone)
+	}
+
+	fg, err := parseHexColor(out.ForegroundColor)
+	if err != nil {
+		return out, fmt.Errorf("%w: foreground_color %v", ErrInvalidRenderOptions, err)
+	}
+	bg, err := parseHexColor(out.BackgroundColor)
+	if err != nil {
+		return out, fmt.Errorf("%w: background_color %v", ErrInvalidRenderOptions, err)
+	}
+	out.ForegroundColor = formatHexColor(fg)
+	out.BackgroundColor = formatHexColor(bg)
+
+	// Most scanners expect dark modules on a light background
+	if relativeLuminance(fg) >= relativeLuminance(bg) {
+		return out, fmt.Errorf("%w: foreground_color must be darker than background_color", ErrInvalidRenderOptions)
+	}
+	if ratio := contrastRatio(fg, bg); ratio < minQRContrast {
+		return out, fmt.Errorf("%w: contrast ratio %.2f is below the minimum of %.1f", ErrInvalidRenderOptions, ratio, minQRContrast)
+	}
+
+	return out, nil
+}
+
+// qrMatrix encodes content and returns its module matrix without a quiet zone.
+// matrix[y][x] is true for a dark module.
+func qrMatrix(content, level string) ([][]bool, error) {
+	q, err := qrcode.New(content, qrLevels[level])
+	if err != nil {
+		return nil, err
+	}
+	q.DisableBorder = true
+	return q.Bitmap(), nil
+}
+
+// qrLayout returns the pixel size of one module and the offset of the first
+// symbol module when n modules plus the quiet zone are drawn in size pixels.
+func qrLayout(n int, opts domain.QRRenderOptions, size int) (moduleSize, offset int) {
+	moduleSize = size / (n + 2*opts.QuietZone)
+	offset = (size - moduleSize*n) / 2
+	return moduleSize, offset
+}
+
+// renderQRImage draws the module matrix at exactly size x size pixels. Every
+// module gets the same integer pixel width; leftover pixels are split evenly
+// around the quiet zone.
+func renderQRImage(matrix [][]bool, opts domain.QRRenderOptions, size int) (*image.Paletted, error) {
+	moduleSize, offset := qrLayout(len(matrix), opts, size)
+	if moduleSize < 1 {
+		return nil, fmt.Errorf("%w: %dpx is too small for %d modules", ErrInvalidRenderOptions, size, len(matrix)+2*opts.QuietZone)
+	}
+
+	fg, err := parseHexColor(opts.ForegroundColor)
+	if err != nil {
+		return nil, err
+	}
+	bg, err := parseHexColor(opts.BackgroundColor)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{bg, fg})
+	for y, row := range matrix {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			x0 := offset + x*moduleSize
+			y0 := offset + y*moduleSize
+			for py := y0; py < y0+moduleSize; py++ {
+				line := img.Pix[img.PixOffset(x0, py):]
+				for px := 0; px < moduleSize; px++ {
+					line[px] = 1
+				}
+			}
+		}
+	}
+	return img, nil
+}
+
+// drawQR renders content at size pixels, embedding logo (if any) in the
+// center. With a logo the error correction level is raised until it can
+// recover the covered modules; the returned options carry the level used.
+func drawQR(content string, opts domain.QRRenderOptions, logo image.Image, size int) (image.Image, domain.QRRenderOptions, error) {
+	matrix, err := qrMatrix(content, opts.ErrorCorrection)
+	if err != nil {
+		return nil, opts, err
+	}
+
+	if logo != nil {
+		// A higher level may need a larger version, so re-check after encoding
+		for {
+			required := requiredLogoLevel(len(matrix))
+			if qrLevelRank(required) <= qrLevelRank(opts.ErrorCorrection) {
+				break
+			}
+			opts.ErrorCorrection = required
+			if matrix, err = qrMatrix(content, opts.ErrorCorrection); err != nil {
+				return nil, opts, err
+			}
+		}
+	}
+
+	img, err := renderQRImage(matrix, opts, size)
+	if err != nil {
+		return nil, opts, err
+	}
+	if logo == nil {
+		return img, opts, nil
+	}
+	return compositeLogo(img, len(matrix), opts, logo), opts, nil
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func qrLevelRank(level string) int {
+	return strings.Index("LMQH", level)
+}
+
+func parseHexColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("must be a #RRGGBB hex color, got %q", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("must be a #RRGGBB hex color, got %q", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+func formatHexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B)
+}
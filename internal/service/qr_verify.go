@@ -0,0 +1,136 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/internal/domain"
+)
+
+const (
+	// QRVerifyOff skips the scannability check
+	QRVerifyOff = "off"
+	// QRVerifyWarn reports an unreadable QR as a warning
+	QRVerifyWarn = "warn"
+	// QRVerifyStrict fails the request when the QR cannot be read back
+	QRVerifyStrict = "strict"
+
+	// Margin around the QR included when it is read back, relative to its size
+	verifyMarginRatio = 0.125
+	// JPEG encodes 16x16 pixel blocks (8x8 with 2x2 chroma subsampling)
+	jpegBlockSize = 16
+)
+
+var ErrQRUnreadable = errors.New("qr code is not scannable")
+
+// verifyRegion is the part of img read back for a QR drawn at rect
+func verifyRegion(img image.Image, rect image.Rectangle) image.Rectangle {
+	margin := int(float64(rect.Dx()) * verifyMarginRatio)
+	return rect.Inset(-margin).Intersect(img.Bounds())
+}
+
+func subImage(img image.Image, rect image.Rectangle) image.Image {
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(rect)
+	}
+	return img
+}
+
+// verifyQR reads back the QR drawn at rect in img and checks that it decodes
+// to the campaign's short link.
+func (s *QRCampaignService) verifyQR(campaign *domain.QRCampaign, img image.Image, rect image.Rectangle) error {
+	img = subImage(img, verifyRegion(img, rect))
+
+	text, err := decodeQR(img)
+	if err != nil {
+		return fmt.Errorf("%w: the QR could not be decoded", ErrQRUnreadable)
+	}
+	if want := s.ShortURL(campaign.ShortCode); text != want {
+		return fmt.Errorf("%w: the QR decodes to %q instead of %q", ErrQRUnreadable, text, want)
+	}
+	return nil
+}
+
+// checkScannable runs verifyQR according to mode. In warn mode a failure is
+// returned as the warning message instead of an error.
+func (s *QRCampaignService) checkScannable(campaign *domain.QRCampaign, img image.Image, rect image.Rectangle, mode string) (string, error) {
+	if mode == QRVerifyOff {
+		return "", nil
+	}
+	err := s.verifyQR(campaign, img, rect)
+	if err == nil || mode == QRVerifyStrict {
+		return "", err
+	}
+	return err.Error(), nil
+}
+
+// verifyOutput checks the QR of a processed image and records any warning on
+// result. For the lossy formats (JPEG, and GIF's palette) only the area read
+// back is encoded again with the same settings and decoded, so compression
+// artifacts are taken into account without decoding the whole output. The
+// area is aligned to JPEG's blocks, which are then encoded exactly as in the
+// output. The other formats encode canvas exactly.
+func (s *QRCampaignService) verifyOutput(campaign *domain.QRCampaign, result *ProcessedImage, canvas image.Image, rect image.Rectangle, quality int, mode string) error {
+	if mode == QRVerifyOff {
+		return nil
+	}
+	img := canvas
+	if result.Format == ImageFormatJPEG || result.Format == ImageFormatGIF {
+		region := verifyRegion(canvas, rect)
+		if result.Format == ImageFormatJPEG {
+			region = alignToGrid(region, canvas.Bounds(), jpegBlockSize)
+		}
+		encoded, err := encodeImage(subImage(canvas, region), result.Format, quality)
+		if err != nil {
+			return err
+		}
+		decoded, _, err := image.Decode(bytes.NewReader(encoded.Data))
+		if err != nil {
+			return err
+		}
+		img = decoded
+		rect = rect.Sub(region.Min)
+	}
+	warning, err := s.checkScannable(campaign, img, rect, mode)
+	if err != nil {
+		return err
+	}
+	result.Warning = warning
+	return nil
+}
+
+// alignToGrid grows r to a multiple of size pixels from the origin of bounds,
+// within bounds.
+func alignToGrid(r, bounds image.Rectangle, size int) image.Rectangle {
+	o := bounds.Min
+	r = r.Sub(o)
+	r.Min.X -= r.Min.X % size
+	r.Min.Y -= r.Min.Y % size
+	r.Max.X += (size - r.Max.X%size) % size
+	r.Max.Y += (size - r.Max.Y%size) % size
+	return r.Add(o).Intersect(bounds)
+}
+
+// verifyRenderedQR checks a freshly generated campaign QR. It is placed on a
+// 4-module border of its background color first, so that a campaign with a
+// narrow quiet zone is judged on its modules and logo alone.
+func (s *QRCampaignService) verifyRenderedQR(campaign *domain.QRCampaign, img image.Image) (string, error) {
+	opts := campaign.RenderOptions
+	border := 0
+	if matrix, err := qrMatrix(s.ShortURL(campaign.ShortCode), opts.ErrorCorrection); err == nil {
+		border = img.Bounds().Dx() * minQuietZoneModules / (len(matrix) + 2*opts.QuietZone)
+	}
+	bg, _ := parseHexColor(opts.BackgroundColor)
+
+	b := img.Bounds()
+	canvas := image.NewRGBA(image.Rect(0, 0, b.Dx()+2*border, b.Dy()+2*border))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	rect := image.Rect(border, border, border+b.Dx(), border+b.Dy())
+	draw.Draw(canvas, rect, img, b.Min, draw.Over)
+	return s.checkScannable(campaign, canvas, rect, s.verifyMode)
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// testPhoto is a PNG with a smooth gradient, standing in for an upload
+func testPhoto(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(60 + 120*x/w), G: uint8(90 + 100*y/h), B: 140, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestVerifyOutput(t *testing.T) {
+	photo := testPhoto(t, 600, 400)
+	// The QR is only as large as the image allows, under a pixel per module
+	thumbnail := testPhoto(t, minOverlayFitSize, minOverlayFitSize)
+	faint := func(o *OverlayOptions) {
+		opacity := 0.1
+		o.Opacity = &opacity
+	}
+
+	tests := []struct {
+		name       string
+		upload     []byte
+		configured string
+		verify     string
+		format     string
+		overlay    func(*OverlayOptions)
+		wantErr    bool
+		wantWarn   bool
+	}{
+		{"clean png", photo, QRVerifyStrict, "", ImageFormatPNG, nil, false, false},
+		{"clean jpeg", photo, QRVerifyStrict, "", ImageFormatJPEG, nil, false, false},
+		{"clean gif", photo, QRVerifyStrict, "", ImageFormatGIF, nil, false, false},
+		{"faint strict", photo, QRVerifyStrict, "", ImageFormatPNG, faint, true, false},
+		{"faint warn", photo, QRVerifyWarn, "", ImageFormatPNG, faint, false, true},
+		{"faint off", photo, QRVerifyOff, "", ImageFormatPNG, faint, false, false},
+		{"tiny strict", thumbnail, QRVerifyStrict, "", ImageFormatJPEG, nil, true, false},
+		{"tiny warn", thumbnail, QRVerifyWarn, "", ImageFormatJPEG, nil, false, true},
+		{"request tightens warn", photo, QRVerifyWarn, QRVerifyStrict, ImageFormatPNG, faint, true, false},
+		{"request tightens off", photo, QRVerifyOff, QRVerifyWarn, ImageFormatPNG, faint, false, true},
+		{"request cannot loosen strict", photo, QRVerifyStrict, QRVerifyWarn, ImageFormatPNG, faint, true, false},
+	}
+	for _, tt := range tests {
+		s := newTestService(&fakeCampaignRepo{})
+		s.verifyMode = tt.configured
+		overlay := DefaultOverlayOptions()
+		if tt.overlay != nil {
+			tt.overlay(&overlay)
+		}
+		output, err := OutputOptions{Format: tt.format, Verify: tt.verify}.normalize()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		result, err := s.compositeImage(testCampaign("c"), tt.upload, overlay, output)
+		if tt.wantErr {
+			if !errors.Is(err, ErrQRUnreadable) {
+				t.Errorf("%s: err = %v, want ErrQRUnreadable", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if (result.Warning != "") != tt.wantWarn {
+			t.Errorf("%s: warning = %q, want one: %v", tt.name, result.Warning, tt.wantWarn)
+		}
+	}
+}
+
+func TestOutputVerifyMode(t *testing.T) {
+	tests := []struct {
+		configured, verify, want string
+	}{
+		{QRVerifyOff, "", QRVerifyOff},
+		{QRVerifyOff, QRVerifyWarn, QRVerifyWarn},
+		{QRVerifyOff, QRVerifyStrict, QRVerifyStrict},
+		{QRVerifyWarn, "", QRVerifyWarn},
+		{QRVerifyWarn, QRVerifyStrict, QRVerifyStrict},
+		{QRVerifyStrict, "", QRVerifyStrict},
+		{QRVerifyStrict, QRVerifyWarn, QRVerifyStrict},
+		{QRVerifyStrict, QRVerifyOff, QRVerifyStrict},
+		{QRVerifyWarn, QRVerifyOff, QRVerifyWarn},
+	}
+	for _, tt := range tests {
+		if got := (OutputOptions{Verify: tt.verify}).verifyMode(tt.configured); got != tt.want {
+			t.Errorf("verifyMode(%q) with verify %q = %q, want %q", tt.configured, tt.verify, got, tt.want)
+		}
+	}
+	if _, err := (OutputOptions{Verify: QRVerifyOff}).normalize(); !errors.Is(err, ErrInvalidOutput) {
+		t.Errorf("verify=off accepted: %v", err)
+	}
+}
+
+func TestAlignToGrid(t *testing.T) {
+	bounds := image.Rect(0, 0, 100, 70)
+	tests := []struct {
+		r, want image.Rectangle
+	}{
+		{image.Rect(17, 5, 40, 33), image.Rect(16, 0, 48, 48)},
+		{image.Rect(16, 16, 32, 32), image.Rect(16, 16, 32, 32)},
+		{image.Rect(90, 60, 100, 70), image.Rect(80, 48, 100, 70)},
+	}
+	for _, tt := range tests {
+		if got := alignToGrid(tt.r, bounds, jpegBlockSize); got != tt.want {
+			t.Errorf("alignToGrid(%v) = %v, want %v", tt.r, got, tt.want)
+		}
+	}
+	// The grid starts at the image origin, not at zero
+	offset := bounds.Add(image.Pt(5, 3))
+	if got := alignToGrid(image.Rect(22, 20, 30, 30), offset, jpegBlockSize); got != image.Rect(21, 19, 37, 35) {
+		t.Errorf("offset bounds: got %v", got)
+	}
+}
+
+func TestRenderQRVerify(t *testing.T) {
+	tests := []struct {
+		name       string
+		fg, bg     string
+		configured string
+		wantErr    bool
+		wantWarn   bool
+	}{
+		{"clean", "#000000", "#FFFFFF", QRVerifyStrict, false, false},
+		{"low contrast strict", "#777777", "#888888", QRVerifyStrict, true, false},
+		{"low contrast warn", "#777777", "#888888", QRVerifyWarn, false, true},
+		{"low contrast off", "#777777", "#888888", QRVerifyOff, false, false},
+	}
+	for _, tt := range tests {
+		s := newTestService(&fakeCampaignRepo{})
+		s.verifyMode = tt.configured
+		campaign := testCampaign("c")
+		campaign.RenderOptions.ForegroundColor = tt.fg
+		campaign.RenderOptions.BackgroundColor = tt.bg
+
+		data, err := s.renderQR(campaign)
+		if tt.wantErr {
+			if !errors.Is(err, ErrQRUnreadable) {
+				t.Errorf("%s: err = %v, want ErrQRUnreadable", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+			t.Errorf("%s: rendered QR does not decode: %v", tt.name, err)
+		}
+		if (campaign.ScanWarning != "") != tt.wantWarn {
+			t.Errorf("%s: warning = %q, want one: %v", tt.name, campaign.ScanWarning, tt.wantWarn)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Package workerpool bounds how much CPU-heavy work runs at once. Callers
+// beyond the concurrency limit wait in a queue of fixed depth for at most a
+// timeout, so bursts degrade into fast rejections instead of starving the
+// rest of the server.
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrQueueFull    = errors.New("queue is full")
+	ErrQueueTimeout = errors.New("timed out waiting in queue")
+)
+
+type Pool struct {
+	slots   chan struct{}
+	depth   int64
+	timeout time.Duration
+
+	queued    atomic.Int64
+	rejected  atomic.Int64
+	timedOut  atomic.Int64
+	completed atomic.Int64
+}
+
+// Stats is a snapshot of the pool for monitoring.
+type Stats struct {
+	Concurrency int   `json:"concurrency"`
+	Active      int   `json:"active"`
+	QueueDepth  int64 `json:"queue_depth"`
+	Queued      int64 `json:"queued"`
+	Rejected    int64 `json:"rejected"`
+	TimedOut    int64 `json:"timed_out"`
+	Completed   int64 `json:"completed"`
+}
+
+func New(concurrency, queueDepth int, timeout time.Duration) *Pool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if queueDepth < 0 {
+		queueDepth = 0
+	}
+	return &Pool{
+		slots:   make(chan struct{}, concurrency),
+		depth:   int64(queueDepth),
+		timeout: timeout,
+	}
+}
+
+// Do runs fn on the calling goroutine once a slot is free. It returns
+// ErrQueueFull when the queue is already at depth, ErrQueueTimeout when no
+// slot frees up in time, or ctx.Err() if the caller gives up first.
+func (p *Pool) Do(ctx context.Context, fn func() error) error {
+	if err := p.acquire(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		<-p.slots
+		p.completed.Add(1)
+	}()
+	return fn()
+}
+
+func (p *Pool) acquire(ctx context.Context) error {
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if p.queued.Add(1) > p.depth {
+		p.queued.Add(-1)
+		p.rejected.Add(1)
+		return ErrQueueFull
+	}
+	defer p.queued.Add(-1)
+
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		p.timedOut.Add(1)
+		return ErrQueueTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Pool) Stats() Stats {
+	return Stats{
+		Concurrency: cap(p.slots),
+		Active:      len(p.slots),
+		QueueDepth:  p.depth,
+		Queued:      p.queued.Load(),
+		Rejected:    p.rejected.Load(),
+		TimedOut:    p.timedOut.Load(),
+		Completed:   p.completed.Load(),
+	}
+}
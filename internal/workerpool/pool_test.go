@@ -0,0 +1,136 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitFor polls until cond holds, failing the test after a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// occupy runs a job on p that holds its slot until release is closed.
+func occupy(t *testing.T, p *Pool, release chan struct{}) <-chan error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Do(context.Background(), func() error {
+			<-release
+			return nil
+		})
+	}()
+	return done
+}
+
+func TestPoolQueueLimits(t *testing.T) {
+	p := New(1, 1, 50*time.Millisecond)
+	release := make(chan struct{})
+	worker := occupy(t, p, release)
+	waitFor(t, "the worker to start", func() bool { return p.Stats().Active == 1 })
+
+	// The second caller waits in the queue and times out
+	queued := make(chan error, 1)
+	go func() {
+		queued <- p.Do(context.Background(), func() error { return nil })
+	}()
+	waitFor(t, "the caller to queue", func() bool { return p.Stats().Queued == 1 })
+
+	// The queue is full, so the third is rejected at once
+	ran := false
+	if err := p.Do(context.Background(), func() error { ran = true; return nil }); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("third caller: err = %v, want ErrQueueFull", err)
+	}
+	if ran {
+		t.Error("rejected job ran")
+	}
+
+	if err := <-queued; !errors.Is(err, ErrQueueTimeout) {
+		t.Errorf("queued caller: err = %v, want ErrQueueTimeout", err)
+	}
+
+	close(release)
+	if err := <-worker; err != nil {
+		t.Errorf("worker: %v", err)
+	}
+
+	want := Stats{Concurrency: 1, Active: 0, QueueDepth: 1, Queued: 0, Rejected: 1, TimedOut: 1, Completed: 1}
+	if got := p.Stats(); got != want {
+		t.Errorf("Stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestPoolQueuedCallerRuns(t *testing.T) {
+	p := New(2, 2, time.Second)
+	release := make(chan struct{})
+	workers := []<-chan error{occupy(t, p, release), occupy(t, p, release)}
+	waitFor(t, "the workers to start", func() bool { return p.Stats().Active == 2 })
+
+	queued := make(chan error, 1)
+	go func() {
+		queued <- p.Do(context.Background(), func() error { return errors.New("job error") })
+	}()
+	waitFor(t, "the caller to queue", func() bool { return p.Stats().Queued == 1 })
+	if s := p.Stats(); s.Active != 2 || s.Rejected != 0 {
+		t.Errorf("Stats while saturated = %+v", s)
+	}
+
+	// Freeing a slot lets the queued caller in, and its error is returned
+	close(release)
+	if err := <-queued; err == nil || err.Error() != "job error" {
+		t.Errorf("queued caller: err = %v, want the job's error", err)
+	}
+	for _, w := range workers {
+		<-w
+	}
+	if s := p.Stats(); s.Completed != 3 || s.Queued != 0 || s.TimedOut != 0 {
+		t.Errorf("Stats = %+v, want 3 completed and nothing queued", s)
+	}
+}
+
+func TestPoolContextCancel(t *testing.T) {
+	p := New(1, 1, time.Minute)
+	release := make(chan struct{})
+	defer close(release)
+	occupy(t, p, release)
+	waitFor(t, "the worker to start", func() bool { return p.Stats().Active == 1 })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	queued := make(chan error, 1)
+	go func() {
+		queued <- p.Do(ctx, func() error { return nil })
+	}()
+	waitFor(t, "the caller to queue", func() bool { return p.Stats().Queued == 1 })
+	cancel()
+
+	if err := <-queued; !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if s := p.Stats(); s.Queued != 0 || s.TimedOut != 0 || s.Rejected != 0 {
+		t.Errorf("Stats = %+v, want the cancelled caller to leave no trace", s)
+	}
+}
+
+func TestPoolWithoutQueue(t *testing.T) {
+	p := New(0, -1, time.Second)
+	if s := p.Stats(); s.Concurrency != 1 || s.QueueDepth != 0 {
+		t.Fatalf("Stats = %+v, want concurrency 1 and no queue", s)
+	}
+	release := make(chan struct{})
+	defer close(release)
+	occupy(t, p, release)
+	waitFor(t, "the worker to start", func() bool { return p.Stats().Active == 1 })
+
+	if err := p.Do(context.Background(), func() error { return nil }); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("err = %v, want ErrQueueFull", err)
+	}
+}
@@ -0,0 +1,151 @@
+// Package density writes the print resolution (dots per inch) into encoded
+// images, so print tools lay them out at the intended physical size. Each
+// function returns the data unchanged when it is not a well-formed file of
+// that format.
+package density
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+)
+
+const inchesPerMetre = 1 / 0.0254
+
+var (
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+	jfifHeader   = []byte("JFIF\x00")
+)
+
+// PNG returns a PNG file with a pHYs chunk (pixels per metre) right after the
+// IHDR chunk. An existing pHYs chunk is replaced.
+func PNG(png []byte, dpi int) []byte {
+	// 8 byte signature + IHDR (4 length, 4 type, 13 data, 4 CRC)
+	const afterIHDR = 8 + 4 + 4 + 13 + 4
+	if len(png) < afterIHDR || !bytes.HasPrefix(png, pngSignature) {
+		return png
+	}
+	ppm := uint32(math.Round(float64(dpi) * inchesPerMetre))
+
+	chunk := make([]byte, 8, 8+9+4)
+	binary.BigEndian.PutUint32(chunk, 9)
+	copy(chunk[4:], "pHYs")
+	chunk = binary.BigEndian.AppendUint32(chunk, ppm)
+	chunk = binary.BigEndian.AppendUint32(chunk, ppm)
+	chunk = append(chunk, 1) // unit: metre
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	out := make([]byte, 0, len(png)+len(chunk))
+	out = append(out, png[:afterIHDR]...)
+	out = append(out, chunk...)
+	rest := png[afterIHDR:]
+	for len(rest) >= 12 {
+		n := int(binary.BigEndian.Uint32(rest)) + 12
+		if n < 12 || n > len(rest) {
+			return png
+		}
+		if string(rest[4:8]) != "pHYs" {
+			out = append(out, rest[:n]...)
+		}
+		rest = rest[n:]
+	}
+	if len(rest) != 0 {
+		return png
+	}
+	return out
+}
+
+// JPEG returns a JPEG file whose first segment is a JFIF APP0 with the
+// density in dots per inch. An existing JFIF segment is replaced; JFIF must
+// come first, so call this after inserting any other segments.
+func JPEG(jpeg []byte, dpi int) []byte {
+	if len(jpeg) < 4 || jpeg[0] != 0xff || jpeg[1] != 0xd8 {
+		return jpeg
+	}
+	d := uint16(min(dpi, math.MaxUint16))
+	segment := []byte{0xff, 0xe0, 0, 16}
+	segment = append(segment, jfifHeader...)
+	segment = append(segment, 1, 2, 1) // version 1.02, units: dots per inch
+	segment = binary.BigEndian.AppendUint16(segment, d)
+	segment = binary.BigEndian.AppendUint16(segment, d)
+	segment = append(segment, 0, 0) // no thumbnail
+
+	rest := jpeg[2:]
+	if len(rest) >= 4 && rest[0] == 0xff && rest[1] == 0xe0 {
+		n := int(binary.BigEndian.Uint16(rest[2:])) + 2
+		if n <= len(rest) && bytes.HasPrefix(rest[4:], jfifHeader) {
+			rest = rest[n:]
+		}
+	}
+
+	out := make([]byte, 0, 2+len(segment)+len(rest))
+	out = append(out, jpeg[:2]...)
+	out = append(out, segment...)
+	return append(out, rest...)
+}
+
+// BMP sets the pixels-per-metre fields of a BMP's BITMAPINFOHEADER.
+func BMP(bmp []byte, dpi int) []byte {
+	// 14 byte file header; the resolution follows 24 bytes into the info header
+	if len(bmp) < 14+32 || bmp[0] != 'B' || bmp[1] != 'M' {
+		return bmp
+	}
+	ppm := uint32(math.Round(float64(dpi) * inchesPerMetre))
+	out := bytes.Clone(bmp)
+	binary.LittleEndian.PutUint32(out[38:], ppm)
+	binary.LittleEndian.PutUint32(out[42:], ppm)
+	return out
+}
+
+// TIFF sets the XResolution and YResolution tags of the first IFD and its
+// ResolutionUnit to inches. Tags the file does not have are left out.
+func TIFF(tiff []byte, dpi int) []byte {
+	if len(tiff) < 8 {
+		return tiff
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return tiff
+	}
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return tiff
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	if offset+2+12*count > len(tiff) {
+		return tiff
+	}
+
+	const (
+		tagXResolution    = 282
+		tagYResolution    = 283
+		tagResolutionUnit = 296
+		typeShort         = 3
+		typeRational      = 5
+		unitInch          = 2
+	)
+	out := bytes.Clone(tiff)
+	for i := 0; i < count; i++ {
+		entry := out[offset+2+12*i:]
+		tag, typ := order.Uint16(entry), order.Uint16(entry[2:])
+		switch {
+		case (tag == tagXResolution || tag == tagYResolution) && typ == typeRational:
+			// Rationals do not fit in the entry, so the value is an offset
+			value := int(order.Uint32(entry[8:]))
+			if value < 0 || value+8 > len(out) {
+				return tiff
+			}
+			order.PutUint32(out[value:], uint32(dpi))
+			order.PutUint32(out[value+4:], 1)
+		case tag == tagResolutionUnit && typ == typeShort:
+			order.PutUint16(entry[8:], unitInch)
+		}
+	}
+	return out
+}
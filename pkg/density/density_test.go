@@ -0,0 +1,223 @@
+package density
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/IMPHNEN/imphnen-backend-qr/pkg/exif"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+var testImage = image.NewGray(image.Rect(0, 0, 5, 3))
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// pngChunks splits a PNG after its signature, checking every CRC.
+func pngChunks(t *testing.T, data []byte) []pngChunk {
+	t.Helper()
+	var chunks []pngChunk
+	rest := data[len(pngSignature):]
+	for len(rest) >= 12 {
+		n := int(binary.BigEndian.Uint32(rest))
+		if 12+n > len(rest) {
+			t.Fatalf("chunk %q overruns the file", rest[4:8])
+		}
+		if crc := binary.BigEndian.Uint32(rest[8+n:]); crc != crc32.ChecksumIEEE(rest[4:8+n]) {
+			t.Fatalf("chunk %q has a bad CRC", rest[4:8])
+		}
+		chunks = append(chunks, pngChunk{string(rest[4:8]), rest[8 : 8+n]})
+		rest = rest[12+n:]
+	}
+	if len(rest) != 0 {
+		t.Fatalf("%d trailing bytes", len(rest))
+	}
+	return chunks
+}
+
+func TestPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage); err != nil {
+		t.Fatal(err)
+	}
+	// Setting the density twice replaces the first pHYs chunk
+	data := PNG(PNG(buf.Bytes(), 72), 300)
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("decoding: %v", err)
+	}
+
+	chunks := pngChunks(t, data)
+	if chunks[0].typ != "IHDR" || chunks[1].typ != "pHYs" {
+		t.Fatalf("chunks start %q, %q; want IHDR, pHYs", chunks[0].typ, chunks[1].typ)
+	}
+	phys := 0
+	for _, c := range chunks {
+		if c.typ == "pHYs" {
+			phys++
+		}
+	}
+	if phys != 1 {
+		t.Errorf("%d pHYs chunks, want 1", phys)
+	}
+	// 300 dpi is 11811 pixels per metre
+	want := []byte{0, 0, 0x2e, 0x23, 0, 0, 0x2e, 0x23, 1}
+	if !bytes.Equal(chunks[1].data, want) {
+		t.Errorf("pHYs = %x, want %x", chunks[1].data, want)
+	}
+
+	badLength := bytes.Clone(buf.Bytes())
+	binary.BigEndian.PutUint32(badLength[33:], 0xfffffff0)
+	for name, in := range map[string][]byte{
+		"not a PNG":                  []byte("GIF89a-------------------------------------"),
+		"truncated in IHDR":          buf.Bytes()[:20],
+		"chunk length past the end":  badLength,
+		"truncated after IHDR chunk": buf.Bytes()[:40],
+	} {
+		if got := PNG(in, 300); !bytes.Equal(got, in) {
+			t.Errorf("%s: data was changed", name)
+		}
+	}
+}
+
+func TestJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage, nil); err != nil {
+		t.Fatal(err)
+	}
+	tiffBlock := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x00\x00\x00\x00\x00")
+	// As in processing: EXIF is inserted first, then the density, which must
+	// end up in the first segment; a second call replaces it.
+	data := JPEG(JPEG(exif.InsertJPEG(buf.Bytes(), tiffBlock), 72), 300)
+
+	if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("decoding: %v", err)
+	}
+	if !bytes.Equal(data[2:4], []byte{0xff, 0xe0}) || !bytes.Equal(data[6:11], jfifHeader) {
+		t.Fatalf("first segment is not JFIF: %x", data[2:11])
+	}
+	if units, x, y := data[13], binary.BigEndian.Uint16(data[14:]), binary.BigEndian.Uint16(data[16:]); units != 1 || x != 300 || y != 300 {
+		t.Errorf("density = %d x %d (units %d), want 300 x 300 dpi", x, y, units)
+	}
+	if n := bytes.Count(data, jfifHeader); n != 1 {
+		t.Errorf("%d JFIF segments, want 1", n)
+	}
+	if !bytes.Equal(data[20:22], []byte{0xff, 0xe1}) {
+		t.Errorf("EXIF does not follow JFIF: %x", data[20:22])
+	}
+	if got := exif.FromJPEG(data); !bytes.Equal(got, tiffBlock) {
+		t.Errorf("EXIF block = %x, want %x", got, tiffBlock)
+	}
+
+	for name, in := range map[string][]byte{
+		"empty":      nil,
+		"not a JPEG": []byte("\x89PNG"),
+		"only SOI":   {0xff, 0xd8},
+	} {
+		if got := JPEG(in, 300); !bytes.Equal(got, in) {
+			t.Errorf("%s: data was changed", name)
+		}
+	}
+	// A JFIF-looking segment whose length overruns the file is kept as is
+	overrun := []byte{0xff, 0xd8, 0xff, 0xe0, 0xff, 0xff, 'J', 'F', 'I', 'F', 0}
+	if got := JPEG(overrun, 300); !bytes.HasSuffix(got, overrun[2:]) {
+		t.Errorf("overrunning segment was dropped: %x", got)
+	}
+}
+
+func TestBMP(t *testing.T) {
+	var buf bytes.Buffer
+	if err := bmp.Encode(&buf, testImage); err != nil {
+		t.Fatal(err)
+	}
+	input := bytes.Clone(buf.Bytes())
+	data := BMP(buf.Bytes(), 254)
+	if _, err := bmp.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("decoding: %v", err)
+	}
+	// 254 dpi is exactly 10000 pixels per metre
+	if x, y := binary.LittleEndian.Uint32(data[38:]), binary.LittleEndian.Uint32(data[42:]); x != 10000 || y != 10000 {
+		t.Errorf("resolution = %d x %d, want 10000 x 10000", x, y)
+	}
+	if !bytes.Equal(buf.Bytes(), input) {
+		t.Error("input was modified")
+	}
+	if got := BMP(buf.Bytes()[:40], 254); !bytes.Equal(got, buf.Bytes()[:40]) {
+		t.Error("truncated BMP was changed")
+	}
+}
+
+// tiffResolution reads XResolution, YResolution and ResolutionUnit
+func tiffResolution(t *testing.T, data []byte) (x, y [2]uint32, unit uint16) {
+	t.Helper()
+	order := binary.ByteOrder(binary.LittleEndian)
+	if string(data[:2]) == "MM" {
+		order = binary.BigEndian
+	}
+	offset := int(order.Uint32(data[4:]))
+	count := int(order.Uint16(data[offset:]))
+	for i := 0; i < count; i++ {
+		entry := data[offset+2+12*i:]
+		value := int(order.Uint32(entry[8:]))
+		switch order.Uint16(entry) {
+		case 282:
+			x = [2]uint32{order.Uint32(data[value:]), order.Uint32(data[value+4:])}
+		case 283:
+			y = [2]uint32{order.Uint32(data[value:]), order.Uint32(data[value+4:])}
+		case 296:
+			unit = order.Uint16(entry[8:])
+		}
+	}
+	return x, y, unit
+}
+
+func TestTIFF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := tiff.Encode(&buf, testImage, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := TIFF(buf.Bytes(), 600)
+	if _, err := tiff.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("decoding: %v", err)
+	}
+	x, y, unit := tiffResolution(t, data)
+	if x != [2]uint32{600, 1} || y != [2]uint32{600, 1} || unit != 2 {
+		t.Errorf("resolution = %v x %v (unit %d), want 600/1 dpi", x, y, unit)
+	}
+	if x, _, _ := tiffResolution(t, buf.Bytes()); x != [2]uint32{72, 1} {
+		t.Errorf("input was modified: %v", x)
+	}
+
+	offset := int(binary.LittleEndian.Uint32(buf.Bytes()[4:]))
+	badOffset := bytes.Clone(buf.Bytes())
+	binary.LittleEndian.PutUint32(badOffset[4:], uint32(len(badOffset)))
+	hugeCount := bytes.Clone(buf.Bytes())
+	binary.LittleEndian.PutUint16(hugeCount[offset:], 0xffff)
+	badRational := bytes.Clone(buf.Bytes())
+	count := int(binary.LittleEndian.Uint16(badRational[offset:]))
+	for i := 0; i < count; i++ {
+		entry := badRational[offset+2+12*i:]
+		if binary.LittleEndian.Uint16(entry) == 282 {
+			binary.LittleEndian.PutUint32(entry[8:], uint32(len(badRational)-4))
+		}
+	}
+
+	for name, in := range map[string][]byte{
+		"empty":                 nil,
+		"unknown byte order":    append([]byte("XX"), buf.Bytes()[2:]...),
+		"IFD offset past end":   badOffset,
+		"entry count past end":  hugeCount,
+		"rational past the end": badRational,
+	} {
+		if got := TIFF(in, 600); !bytes.Equal(got, in) {
+			t.Errorf("%s: data was changed", name)
+		}
+	}
+}
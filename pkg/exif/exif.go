@@ -0,0 +1,205 @@
+// Package exif reads and rewrites the parts of EXIF metadata needed to
+// display photos upright: the Orientation tag of IFD0. EXIF blocks are
+// handled as raw TIFF data (without the "Exif\0\0" prefix of JPEG APP1).
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/draw"
+)
+
+const (
+	tagOrientation = 0x0112
+	ifdEntrySize   = 12
+	maxJPEGSegment = 0xffff - 2
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// FromJPEG returns the EXIF block of a JPEG file, or nil if it has none.
+func FromJPEG(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return nil
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xff:
+			// Fill byte
+			i++
+			continue
+		case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7):
+			i += 2
+			continue
+		case marker == 0xda || marker == 0xd9:
+			// Metadata segments all come before the scan data
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil
+		}
+		payload := data[i+4 : end]
+		if marker == 0xe1 && bytes.HasPrefix(payload, exifHeader) {
+			return payload[len(exifHeader):]
+		}
+		i = end
+	}
+	return nil
+}
+
+// ifd0 locates the first IFD of a TIFF block. It returns the byte order and
+// the offset of the entry count, or ok=false if the block is malformed.
+func ifd0(tiff []byte) (order binary.ByteOrder, offset int, count int, ok bool) {
+	if len(tiff) < 8 {
+		return nil, 0, 0, false
+	}
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, 0, 0, false
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return nil, 0, 0, false
+	}
+	offset = int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return nil, 0, 0, false
+	}
+	count = int(order.Uint16(tiff[offset:]))
+	if offset+2+count*ifdEntrySize+4 > len(tiff) {
+		return nil, 0, 0, false
+	}
+	return order, offset, count, true
+}
+
+// Orientation returns the Orientation tag (1-8) of an EXIF block, or 1 when
+// it is missing or invalid.
+func Orientation(tiff []byte) int {
+	order, offset, count, ok := ifd0(tiff)
+	if !ok {
+		return 1
+	}
+	for i := 0; i < count; i++ {
+		entry := tiff[offset+2+i*ifdEntrySize:]
+		if order.Uint16(entry) != tagOrientation {
+			continue
+		}
+		// SHORT, count 1: the value sits in the first two bytes of the field
+		if v := int(order.Uint16(entry[8:])); v >= 1 && v <= 8 {
+			return v
+		}
+		return 1
+	}
+	return 1
+}
+
+// WithoutOrientation returns a copy of the EXIF block with the Orientation
+// tag removed from IFD0. Other offsets are absolute, so they stay valid.
+func WithoutOrientation(tiff []byte) []byte {
+	out := append([]byte(nil), tiff...)
+	order, offset, count, ok := ifd0(out)
+	if !ok {
+		return out
+	}
+	entries := out[offset+2:]
+	for i := 0; i < count; i++ {
+		if order.Uint16(entries[i*ifdEntrySize:]) != tagOrientation {
+			continue
+		}
+		// Shift the following entries and the next-IFD offset up one slot
+		end := count*ifdEntrySize + 4
+		copy(entries[i*ifdEntrySize:end-ifdEntrySize], entries[(i+1)*ifdEntrySize:end])
+		order.PutUint16(out[offset:], uint16(count-1))
+		return out
+	}
+	return out
+}
+
+// InsertJPEG returns a JPEG file with an APP1 segment holding the EXIF block
+// right after the SOI marker. Blocks too large for one segment are dropped.
+func InsertJPEG(jpeg, tiff []byte) []byte {
+	size := len(exifHeader) + len(tiff) + 2
+	if len(jpeg) < 2 || size > maxJPEGSegment+2 {
+		return jpeg
+	}
+	out := make([]byte, 0, len(jpeg)+size+2)
+	out = append(out, jpeg[:2]...)
+	out = append(out, 0xff, 0xe1, byte(size>>8), byte(size))
+	out = append(out, exifHeader...)
+	out = append(out, tiff...)
+	return append(out, jpeg[2:]...)
+}
+
+// InsertPNG returns a PNG file with an eXIf chunk holding the EXIF block
+// right after the IHDR chunk.
+func InsertPNG(png, tiff []byte) []byte {
+	// 8 byte signature + IHDR (4 length, 4 type, 13 data, 4 CRC)
+	const afterIHDR = 8 + 4 + 4 + 13 + 4
+	if len(png) < afterIHDR {
+		return png
+	}
+	chunk := make([]byte, 8, 8+len(tiff)+4)
+	binary.BigEndian.PutUint32(chunk, uint32(len(tiff)))
+	copy(chunk[4:], "eXIf")
+	chunk = append(chunk, tiff...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	out := make([]byte, 0, len(png)+len(chunk))
+	out = append(out, png[:afterIHDR]...)
+	out = append(out, chunk...)
+	return append(out, png[afterIHDR:]...)
+}
+
+// Orient returns img transformed so that it displays upright for the given
+// Orientation value. Orientation 1 (or any invalid value) returns img as is.
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirror horizontal
+				sx, sy = w-1-x, y
+			case 3: // rotate 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirror vertical
+				sx, sy = x, h-1-y
+			case 5: // transpose
+				sx, sy = y, x
+			case 6: // rotate 90 clockwise
+				sx, sy = y, h-1-x
+			case 7: // transverse
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotate 90 counter-clockwise
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):][:4], src.Pix[src.PixOffset(sx, sy):][:4])
+		}
+	}
+	return dst
+}
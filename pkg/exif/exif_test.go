@@ -0,0 +1,256 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+type ifdEntry struct {
+	tag, typ uint16
+	count    uint32
+	value    uint32
+}
+
+// buildTIFF returns a TIFF block whose IFD0 holds entries, followed by the
+// next-IFD offset. SHORT values are stored left-justified in the value field.
+func buildTIFF(order byteOrder, entries []ifdEntry, nextIFD uint32) []byte {
+	var tiff []byte
+	if order == binary.LittleEndian {
+		tiff = append(tiff, "II"...)
+	} else {
+		tiff = append(tiff, "MM"...)
+	}
+	tiff = order.AppendUint16(tiff, 42)
+	tiff = order.AppendUint32(tiff, 8)
+	tiff = order.AppendUint16(tiff, uint16(len(entries)))
+	for _, e := range entries {
+		tiff = order.AppendUint16(tiff, e.tag)
+		tiff = order.AppendUint16(tiff, e.typ)
+		tiff = order.AppendUint32(tiff, e.count)
+		if e.typ == 3 {
+			tiff = order.AppendUint16(tiff, uint16(e.value))
+			tiff = append(tiff, 0, 0)
+		} else {
+			tiff = order.AppendUint32(tiff, e.value)
+		}
+	}
+	return order.AppendUint32(tiff, nextIFD)
+}
+
+func orientationTIFF(order byteOrder, v uint32) []byte {
+	return buildTIFF(order, []ifdEntry{
+		{tag: 0x010f, typ: 2, count: 4, value: 0x41424300}, // Make
+		{tag: tagOrientation, typ: 3, count: 1, value: v},
+		{tag: 0x0131, typ: 2, count: 4, value: 0x58595a00}, // Software
+	}, 0x1234)
+}
+
+func TestOrientation(t *testing.T) {
+	for _, order := range []byteOrder{binary.LittleEndian, binary.BigEndian} {
+		for v := 1; v <= 8; v++ {
+			if got := Orientation(orientationTIFF(order, uint32(v))); got != v {
+				t.Errorf("%v: Orientation = %d, want %d", order, got, v)
+			}
+		}
+	}
+
+	valid := orientationTIFF(binary.LittleEndian, 6)
+	badMagic := bytes.Clone(valid)
+	badMagic[2] = 43
+	badOffset := bytes.Clone(valid)
+	binary.LittleEndian.PutUint32(badOffset[4:], uint32(len(valid)))
+	hugeCount := bytes.Clone(valid)
+	binary.LittleEndian.PutUint16(hugeCount[8:], 0xffff)
+
+	tests := []struct {
+		name string
+		tiff []byte
+	}{
+		{"nil", nil},
+		{"value 0", orientationTIFF(binary.LittleEndian, 0)},
+		{"value 9", orientationTIFF(binary.BigEndian, 9)},
+		{"missing tag", buildTIFF(binary.LittleEndian, []ifdEntry{{tag: 0x010f, typ: 2, count: 4}}, 0)},
+		{"unknown byte order", append([]byte("XX"), valid[2:]...)},
+		{"bad magic", badMagic},
+		{"IFD offset past the end", badOffset},
+		{"entry count past the end", hugeCount},
+	}
+	for _, tt := range tests {
+		if got := Orientation(tt.tiff); got != 1 {
+			t.Errorf("%s: Orientation = %d, want 1", tt.name, got)
+		}
+	}
+
+	// Every truncation must be rejected without reading out of bounds
+	for n := 0; n < len(valid); n++ {
+		if got := Orientation(valid[:n]); got != 1 {
+			t.Errorf("truncated to %d bytes: Orientation = %d, want 1", n, got)
+		}
+	}
+}
+
+func TestWithoutOrientation(t *testing.T) {
+	for _, order := range []byteOrder{binary.LittleEndian, binary.BigEndian} {
+		tiff := orientationTIFF(order, 6)
+		out := WithoutOrientation(tiff)
+
+		if Orientation(out) != 1 {
+			t.Errorf("%v: orientation still set", order)
+		}
+		_, offset, count, ok := ifd0(out)
+		if !ok || count != 2 {
+			t.Fatalf("%v: IFD0 has %d entries (ok=%v), want 2", order, count, ok)
+		}
+		entries := out[offset+2:]
+		if tag := order.Uint16(entries); tag != 0x010f {
+			t.Errorf("%v: first entry tag = %#x, want Make", order, tag)
+		}
+		if tag := order.Uint16(entries[ifdEntrySize:]); tag != 0x0131 {
+			t.Errorf("%v: second entry tag = %#x, want Software", order, tag)
+		}
+		if v := order.Uint32(entries[ifdEntrySize+8:]); v != 0x58595a00 {
+			t.Errorf("%v: Software value = %#x, want it kept", order, v)
+		}
+		if next := order.Uint32(entries[2*ifdEntrySize:]); next != 0x1234 {
+			t.Errorf("%v: next IFD offset = %#x, want 0x1234", order, next)
+		}
+		if Orientation(tiff) != 6 {
+			t.Errorf("%v: input was modified", order)
+		}
+	}
+
+	// Blocks without the tag, and malformed ones, are copied unchanged
+	plain := buildTIFF(binary.LittleEndian, []ifdEntry{{tag: 0x010f, typ: 2, count: 4}}, 0)
+	valid := orientationTIFF(binary.LittleEndian, 3)
+	for _, tiff := range [][]byte{plain, valid[:len(valid)-1], valid[:9], nil} {
+		if out := WithoutOrientation(tiff); !bytes.Equal(out, tiff) {
+			t.Errorf("WithoutOrientation(%x) = %x, want unchanged", tiff, out)
+		}
+	}
+}
+
+func encodeJPEG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 16, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestJPEGRoundTrip(t *testing.T) {
+	plain := encodeJPEG(t)
+	if FromJPEG(plain) != nil {
+		t.Error("FromJPEG found EXIF in a plain JPEG")
+	}
+
+	tiff := orientationTIFF(binary.BigEndian, 8)
+	data := InsertJPEG(plain, tiff)
+	if got := FromJPEG(data); !bytes.Equal(got, tiff) {
+		t.Errorf("FromJPEG = %x, want %x", got, tiff)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("decoding JPEG with EXIF: %v", err)
+	}
+
+	// Blocks that do not fit in one segment are dropped
+	if got := InsertJPEG(plain, make([]byte, maxJPEGSegment)); !bytes.Equal(got, plain) {
+		t.Error("InsertJPEG kept an oversized block")
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not a JPEG", []byte("GIF89a....")},
+		{"segment length past the end", append([]byte{0xff, 0xd8, 0xff, 0xe1, 0xff, 0xff}, exifHeader...)},
+		{"segment length below 2", []byte{0xff, 0xd8, 0xff, 0xe1, 0x00, 0x01, 0, 0}},
+		{"garbage between segments", []byte{0xff, 0xd8, 0x00, 0xe1, 0x00, 0x08}},
+	}
+	for _, tt := range tests {
+		if got := FromJPEG(tt.data); got != nil {
+			t.Errorf("%s: FromJPEG = %x, want nil", tt.name, got)
+		}
+	}
+	for n := 0; n < len(data); n++ {
+		// Must not panic; a cut inside the APP1 segment loses the block
+		if got := FromJPEG(data[:n]); got != nil && !bytes.Equal(got, tiff) {
+			t.Errorf("truncated to %d bytes: FromJPEG = %x", n, got)
+		}
+	}
+}
+
+func TestInsertPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	tiff := orientationTIFF(binary.LittleEndian, 1)
+	data := InsertPNG(buf.Bytes(), tiff)
+
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("decoding PNG with eXIf: %v", err)
+	}
+	const afterIHDR = 8 + 4 + 4 + 13 + 4
+	chunk := data[afterIHDR:]
+	if string(chunk[4:8]) != "eXIf" || !bytes.Equal(chunk[8:8+len(tiff)], tiff) {
+		t.Errorf("eXIf chunk missing after IHDR: %q", chunk[4:8])
+	}
+	if got := InsertPNG(buf.Bytes()[:20], tiff); !bytes.Equal(got, buf.Bytes()[:20]) {
+		t.Error("InsertPNG changed a truncated PNG")
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// A 3x2 image; the spec describes each orientation by where the stored
+	// first row and first column end up when displayed.
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	first := color.RGBA{R: 255, A: 255}  // stored (0,0)
+	second := color.RGBA{G: 255, A: 255} // stored (1,0), along the first row
+	src.Set(0, 0, first)
+	src.Set(1, 0, second)
+
+	tests := []struct {
+		orientation   int
+		w, h          int
+		first, second image.Point
+	}{
+		{1, 3, 2, image.Pt(0, 0), image.Pt(1, 0)},
+		{2, 3, 2, image.Pt(2, 0), image.Pt(1, 0)},
+		{3, 3, 2, image.Pt(2, 1), image.Pt(1, 1)},
+		{4, 3, 2, image.Pt(0, 1), image.Pt(1, 1)},
+		{5, 2, 3, image.Pt(0, 0), image.Pt(0, 1)},
+		{6, 2, 3, image.Pt(1, 0), image.Pt(1, 1)},
+		{7, 2, 3, image.Pt(1, 2), image.Pt(1, 1)},
+		{8, 2, 3, image.Pt(0, 2), image.Pt(0, 1)},
+	}
+	for _, tt := range tests {
+		dst := Orient(src, tt.orientation)
+		if b := dst.Bounds(); b.Dx() != tt.w || b.Dy() != tt.h {
+			t.Errorf("orientation %d: size %dx%d, want %dx%d", tt.orientation, b.Dx(), b.Dy(), tt.w, tt.h)
+			continue
+		}
+		if got := color.RGBAModel.Convert(dst.At(tt.first.X, tt.first.Y)); got != first {
+			t.Errorf("orientation %d: first pixel not at %v", tt.orientation, tt.first)
+		}
+		if got := color.RGBAModel.Convert(dst.At(tt.second.X, tt.second.Y)); got != second {
+			t.Errorf("orientation %d: second pixel not at %v", tt.orientation, tt.second)
+		}
+	}
+
+	for _, invalid := range []int{0, 9, -1} {
+		if Orient(src, invalid) != image.Image(src) {
+			t.Errorf("orientation %d: image was transformed", invalid)
+		}
+	}
+}
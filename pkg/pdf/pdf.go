@@ -0,0 +1,197 @@
+// Package pdf writes minimal PDF 1.4 documents made of vector content streams
+// and embedded RGB images. Coordinates are in points (1/72 inch) with the
+// origin at the bottom-left of the page.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A4 page size in points
+const (
+	A4Width  = 595.28
+	A4Height = 841.89
+)
+
+type pdfImage struct {
+	width, height int
+	rgb           []byte
+	alpha         []byte
+}
+
+type page struct {
+	width, height float64
+	content       []byte
+}
+
+// Document collects pages and images until it is written out.
+type Document struct {
+	images []pdfImage
+	pages  []page
+}
+
+func New() *Document {
+	return &Document{}
+}
+
+// AddImage embeds img and returns the resource name to use with the Do
+// operator, e.g. "/Im0 Do". Images are available on every page.
+func (d *Document) AddImage(img image.Image) string {
+	b := img.Bounds()
+	pi := pdfImage{
+		width:  b.Dx(),
+		height: b.Dy(),
+		rgb:    make([]byte, 0, b.Dx()*b.Dy()*3),
+	}
+
+	alpha := make([]byte, 0, b.Dx()*b.Dy())
+	opaque := true
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := img.At(x, y).RGBA()
+			// Un-premultiply so the SMask applies the alpha once
+			if a > 0 && a < 0xffff {
+				r, g, bl = r*0xffff/a, g*0xffff/a, bl*0xffff/a
+			}
+			pi.rgb = append(pi.rgb, byte(r>>8), byte(g>>8), byte(bl>>8))
+			alpha = append(alpha, byte(a>>8))
+			if a != 0xffff {
+				opaque = false
+			}
+		}
+	}
+	if !opaque {
+		pi.alpha = alpha
+	}
+
+	d.images = append(d.images, pi)
+	return fmt.Sprintf("Im%d", len(d.images)-1)
+}
+
+// AddPage appends a page of the given size whose content stream is content.
+func (d *Document) AddPage(width, height float64, content []byte) {
+	d.pages = append(d.pages, page{width: width, height: height, content: content})
+}
+
+// Bytes renders the document.
+func (d *Document) Bytes() ([]byte, error) {
+	w := &writer{offsets: map[int]int{}}
+	w.buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Object numbers: 1 catalog, 2 page tree, then images, then pages
+	next := 3
+	imageRefs := make([]int, len(d.images))
+	for i, img := range d.images {
+		imageRefs[i] = next
+		next++
+		if img.alpha != nil {
+			next++
+		}
+	}
+	pageRefs := make([]int, len(d.pages))
+	for i := range d.pages {
+		pageRefs[i] = next
+		next += 2
+	}
+
+	w.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+
+	var kids bytes.Buffer
+	for _, ref := range pageRefs {
+		fmt.Fprintf(&kids, "%d 0 R ", ref)
+	}
+	w.object(2, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids.String(), len(d.pages)))
+
+	var xobjects bytes.Buffer
+	for i, img := range d.images {
+		ref := imageRefs[i]
+		fmt.Fprintf(&xobjects, "/Im%d %d 0 R ", i, ref)
+
+		smask := ""
+		if img.alpha != nil {
+			smask = fmt.Sprintf(" /SMask %d 0 R", ref+1)
+		}
+		dict := fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8%s",
+			img.width, img.height, smask)
+		if err := w.stream(ref, dict, img.rgb); err != nil {
+			return nil, err
+		}
+		if img.alpha != nil {
+			dict := fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8",
+				img.width, img.height)
+			if err := w.stream(ref+1, dict, img.alpha); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	resources := "<< >>"
+	if xobjects.Len() > 0 {
+		resources = fmt.Sprintf("<< /XObject << %s>> >>", xobjects.String())
+	}
+	for i, p := range d.pages {
+		ref := pageRefs[i]
+		w.object(ref, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources %s /Contents %d 0 R >>",
+			Num(p.width), Num(p.height), resources, ref+1))
+		if err := w.stream(ref+1, "<<", p.content); err != nil {
+			return nil, err
+		}
+	}
+
+	// Cross-reference table
+	xref := w.buf.Len()
+	fmt.Fprintf(&w.buf, "xref\n0 %d\n0000000000 65535 f \n", next)
+	for i := 1; i < next; i++ {
+		fmt.Fprintf(&w.buf, "%010d 00000 n \n", w.offsets[i])
+	}
+	fmt.Fprintf(&w.buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", next, xref)
+
+	return w.buf.Bytes(), nil
+}
+
+// Num formats a coordinate compactly with at most three decimals.
+func Num(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 3, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+type writer struct {
+	buf     bytes.Buffer
+	offsets map[int]int
+}
+
+func (w *writer) object(ref int, body string) {
+	w.offsets[ref] = w.buf.Len()
+	fmt.Fprintf(&w.buf, "%d 0 obj\n%s\nendobj\n", ref, body)
+}
+
+// stream writes a Flate-compressed stream object. dict is the opening of the
+// stream dictionary without its closing ">>".
+func (w *writer) stream(ref int, dict string, data []byte) error {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	w.offsets[ref] = w.buf.Len()
+	fmt.Fprintf(&w.buf, "%d 0 obj\n%s /Filter /FlateDecode /Length %d >>\nstream\n", ref, dict, compressed.Len())
+	if _, err := io.Copy(&w.buf, &compressed); err != nil {
+		return err
+	}
+	w.buf.WriteString("\nendstream\nendobj\n")
+	return nil
+}
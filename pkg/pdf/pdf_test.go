@@ -0,0 +1,196 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+var (
+	startxrefPattern = regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`)
+	trailerPattern   = regexp.MustCompile(`trailer\n<< /Size (\d+) /Root 1 0 R >>`)
+	lengthPattern    = regexp.MustCompile(`/Length (\d+) >>\nstream\n$`)
+)
+
+// parsedPDF is what checkStructure reads back: the objects by number, each
+// from "N 0 obj" up to its "endobj"
+type parsedPDF struct {
+	objects map[int][]byte
+}
+
+// checkStructure validates the cross-reference table of data against the
+// objects it points to.
+func checkStructure(t *testing.T, data []byte) parsedPDF {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) {
+		t.Fatalf("missing header: %q", data[:min(len(data), 16)])
+	}
+	m := startxrefPattern.FindSubmatch(data)
+	if m == nil {
+		t.Fatal("missing startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if xref >= len(data) || !bytes.HasPrefix(data[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+
+	var first, count int
+	rest := data[xref+len("xref\n"):]
+	if _, err := fmt.Sscanf(string(rest), "%d %d\n", &first, &count); err != nil || first != 0 {
+		t.Fatalf("bad xref subsection: %v", err)
+	}
+	rest = rest[bytes.IndexByte(rest, '\n')+1:]
+	// Each entry is exactly 20 bytes
+	if len(rest) < count*20 {
+		t.Fatalf("xref table is truncated")
+	}
+	if string(rest[:20]) != "0000000000 65535 f \n" {
+		t.Errorf("object 0 entry is %q", rest[:20])
+	}
+
+	parsed := parsedPDF{objects: map[int][]byte{}}
+	for i := 1; i < count; i++ {
+		entry := string(rest[i*20 : (i+1)*20])
+		var offset, gen int
+		var kind string
+		if _, err := fmt.Sscanf(entry, "%010d %05d %1s", &offset, &gen, &kind); err != nil || kind != "n" || len(entry) != 20 {
+			t.Fatalf("bad xref entry %d: %q", i, entry)
+		}
+		header := fmt.Sprintf("%d 0 obj\n", i)
+		if offset >= xref || !bytes.HasPrefix(data[offset:], []byte(header)) {
+			t.Fatalf("xref entry %d points at %q", i, data[offset:min(offset+16, len(data))])
+		}
+		end := bytes.Index(data[offset:], []byte("endobj\n"))
+		parsed.objects[i] = data[offset+len(header) : offset+end]
+	}
+
+	if m := trailerPattern.FindSubmatch(rest); m == nil || string(m[1]) != strconv.Itoa(count) {
+		t.Errorf("trailer /Size does not match the %d xref entries", count)
+	}
+	if n := bytes.Count(data, []byte(" 0 obj\n")); n != count-1 {
+		t.Errorf("%d objects in the file, xref lists %d", n, count-1)
+	}
+	return parsed
+}
+
+// streamData inflates a stream object, checking its /Length
+func streamData(t *testing.T, obj []byte) []byte {
+	t.Helper()
+	start := bytes.Index(obj, []byte("stream\n")) + len("stream\n")
+	m := lengthPattern.FindSubmatch(obj[:start])
+	if m == nil {
+		t.Fatalf("not a stream: %q", obj[:min(len(obj), 64)])
+	}
+	length, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(obj[start+length:], []byte("\nendstream\n")) {
+		t.Fatalf("/Length %d does not end at endstream", length)
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(obj[start : start+length]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDocumentStructure(t *testing.T) {
+	opaque := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for i := range opaque.Pix {
+		opaque.Pix[i] = 0xff
+	}
+	translucent := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	translucent.Set(0, 0, color.NRGBA{R: 200, A: 128})
+
+	tests := []struct {
+		name    string
+		images  []image.Image
+		pages   int
+		objects int
+	}{
+		{"empty page", nil, 1, 4},
+		{"opaque image", []image.Image{opaque}, 1, 5},
+		{"image with alpha", []image.Image{translucent}, 1, 6},
+		{"images on several pages", []image.Image{opaque, translucent}, 3, 11},
+	}
+	for _, tt := range tests {
+		doc := New()
+		for _, img := range tt.images {
+			doc.AddImage(img)
+		}
+		var contents [][]byte
+		for i := 0; i < tt.pages; i++ {
+			content := []byte(fmt.Sprintf("0 0 1 rg 10 10 %d 20 re f", 10*(i+1)))
+			contents = append(contents, content)
+			doc.AddPage(A4Width, A4Height, content)
+		}
+		data, err := doc.Bytes()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		parsed := checkStructure(t, data)
+		if len(parsed.objects) != tt.objects {
+			t.Errorf("%s: %d objects, want %d", tt.name, len(parsed.objects), tt.objects)
+		}
+		// Pages come last, each followed by its content stream
+		for i, content := range contents {
+			ref := tt.objects - 2*(tt.pages-i) + 1
+			if !bytes.Contains(parsed.objects[ref], []byte("/Type /Page ")) {
+				t.Errorf("%s: object %d is not page %d", tt.name, ref, i)
+				continue
+			}
+			if got := streamData(t, parsed.objects[ref+1]); !bytes.Equal(got, content) {
+				t.Errorf("%s: page %d content is %q", tt.name, i, got)
+			}
+		}
+	}
+}
+
+func TestImageAlpha(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.NRGBA{R: 200, G: 100, B: 50, A: 255})
+	img.Set(1, 0, color.NRGBA{R: 200, G: 100, B: 50, A: 128})
+
+	doc := New()
+	if name := doc.AddImage(img); name != "Im0" {
+		t.Errorf("resource name %q, want Im0", name)
+	}
+	doc.AddPage(100, 100, []byte("/Im0 Do"))
+	data, err := doc.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed := checkStructure(t, data)
+	if !bytes.Contains(parsed.objects[3], []byte("/SMask 4 0 R")) {
+		t.Errorf("image has no soft mask: %q", parsed.objects[3][:64])
+	}
+	// Colors are stored un-premultiplied, the alpha only in the mask
+	rgb := streamData(t, parsed.objects[3])
+	if want := []byte{200, 100, 50, 200, 100, 50}; !bytes.Equal(rgb, want) {
+		t.Errorf("rgb = %v, want %v", rgb, want)
+	}
+	if alpha := streamData(t, parsed.objects[4]); !bytes.Equal(alpha, []byte{255, 128}) {
+		t.Errorf("alpha = %v, want [255 128]", alpha)
+	}
+}
+
+func TestNum(t *testing.T) {
+	tests := map[float64]string{
+		0: "0", 1: "1", 1.5: "1.5", 595.28: "595.28", 2.0004: "2", 0.1236: "0.124", -0.0001: "0", -3.25: "-3.25",
+	}
+	for v, want := range tests {
+		if got := Num(v); got != want {
+			t.Errorf("Num(%v) = %q, want %q", v, got, want)
+		}
+	}
+}